@@ -0,0 +1,116 @@
+/*
+   Copyright 2020 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package bit_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/nokute78/go-bit/v2"
+	"reflect"
+	"testing"
+)
+
+//go:generate go run ./cmd/bitgen -type=genSample -output=gensample_bitgen_test.go bitgen_test.go
+
+// genSample has methods generated by bitgen.
+type genSample struct {
+	A uint8
+	B int16  `bit:"BE"`
+	C uint32 `bit:"bits=5"`
+	D int8   `bit:"bits=3"`
+	E [6]bit.Bit
+	F bit.Bit
+	_ [3]bit.Bit
+	G float32
+	H bit.Float16
+	I uint64 `bit:"LE"`
+	J [2]uint16
+	K uint16 `bit:"skip"`
+	L int64  `bit:"bits=40"`
+	M uint8  `bit:"-"`
+}
+
+// reflectSample has same fields as genSample, but it is decoded by reflection.
+type reflectSample genSample
+
+func TestBitgen(t *testing.T) {
+	buf := make([]byte, 40)
+	for i := range buf {
+		buf[i] = byte(i*37 + 11)
+	}
+
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		var gen genSample
+		var refl reflectSample
+		if _, err := bit.Unmarshal(buf, bit.Offset{}, order, &gen); err != nil {
+			t.Fatalf("%s: Unmarshal(generated) error:%s", order, err)
+		}
+		if _, err := bit.Unmarshal(buf, bit.Offset{}, order, &refl); err != nil {
+			t.Fatalf("%s: Unmarshal(reflect) error:%s", order, err)
+		}
+		if !reflect.DeepEqual(gen, genSample(refl)) {
+			t.Errorf("%s: mismatch\n generated=%+v\n reflect  =%+v", order, gen, refl)
+		}
+
+		if g, r := bit.Size(gen), bit.Size(refl); g != r {
+			t.Errorf("%s: size mismatch generated=%d reflect=%d", order, g, r)
+		}
+
+		gb, _, err := bit.Marshal(gen, order)
+		if err != nil {
+			t.Fatalf("%s: Marshal(generated) error:%s", order, err)
+		}
+		rb, _, err := bit.Marshal(refl, order)
+		if err != nil {
+			t.Fatalf("%s: Marshal(reflect) error:%s", order, err)
+		}
+		if !bytes.Equal(gb, rb) {
+			t.Errorf("%s: mismatch\n generated=%x\n reflect  =%x", order, gb, rb)
+		}
+	}
+}
+
+func TestBitgenOverflow(t *testing.T) {
+	s := genSample{D: 4}
+	if _, _, err := bit.Marshal(s, binary.LittleEndian); err == nil {
+		t.Errorf("Marshal should fail, D=%d overflows 3 bits", s.D)
+	}
+}
+
+func BenchmarkBitgenRead(b *testing.B) {
+	buf := make([]byte, 40)
+	var s genSample
+	for i := 0; i < b.N; i++ {
+		bit.Unmarshal(buf, bit.Offset{}, binary.LittleEndian, &s)
+	}
+}
+
+func BenchmarkBitgenReadReflect(b *testing.B) {
+	buf := make([]byte, 40)
+	var s reflectSample
+	for i := 0; i < b.N; i++ {
+		bit.Unmarshal(buf, bit.Offset{}, binary.LittleEndian, &s)
+	}
+}
+
+func BenchmarkBitgenWriteReflect(b *testing.B) {
+	var s reflectSample
+	buf := make([]byte, 40)
+	for i := 0; i < b.N; i++ {
+		bit.MarshalInto(buf, bit.Offset{}, binary.LittleEndian, s)
+	}
+}
@@ -0,0 +1,250 @@
+/*
+   Copyright 2020 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package bit
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/goccy/go-reflect"
+	"math/bits"
+)
+
+// BitOrder represents the numbering of bits in a byte.
+// It is independent of the byte order.
+//
+// Bit array with `bit:"msb"` or `bit:"lsb"` always has the i-th bit in the element i.
+// Note that Bit array without the tag in binary.BigEndian is read as an integer,
+// so the element 0 is the last bit. e.g. the first 4 bits of 0x8a (1000|1010) in BigEndian.
+//   [4]Bit               : [0 0 0 1]
+//   [4]Bit `bit:"msb"`   : [1 0 0 0]
+type BitOrder int
+
+const (
+	// LSB0 means that bit 0 is the least significant bit. Bits are read from LSB in a byte.
+	// It is the default bit order of integers in binary.LittleEndian in this package.
+	LSB0 BitOrder = iota
+	// MSB0 means that bit 0 is the most significant bit. Bits are read from MSB in a byte.
+	// It is the default bit order of integers in binary.BigEndian in this package.
+	MSB0
+)
+
+func (bo BitOrder) String() string {
+	if bo == MSB0 {
+		return "MSB0"
+	}
+	return "LSB0"
+}
+
+// bitOrdered is the byte order which numbers bits in bo.
+// It is used if `bit:"msb"` or `bit:"lsb"` differs from the bit order of the byte order.
+type bitOrdered struct {
+	binary.ByteOrder
+	bo BitOrder
+}
+
+// bitOrderOf returns the bit order of order.
+func bitOrderOf(order binary.ByteOrder) BitOrder {
+	if o, ok := order.(bitOrdered); ok {
+		return o.bo
+	}
+	if order == binary.BigEndian {
+		return MSB0
+	}
+	return LSB0
+}
+
+// byteOrderOf returns the byte order of order without the bit order.
+func byteOrderOf(order binary.ByteOrder) binary.ByteOrder {
+	if o, ok := order.(bitOrdered); ok {
+		return o.ByteOrder
+	}
+	return order
+}
+
+// withBitOrder returns the byte order of order which numbers bits in bo.
+func withBitOrder(order binary.ByteOrder, bo BitOrder) binary.ByteOrder {
+	order = byteOrderOf(order)
+	if bitOrderOf(order) == bo {
+		return order
+	}
+	return bitOrdered{order, bo}
+}
+
+// getBits is GetBitsBitEndian which numbers bits in the bit order of order.
+func getBits(b []byte, o Offset, bitSize uint64, order binary.ByteOrder) ([]Bit, error) {
+	if bo, ok := order.(bitOrdered); ok {
+		return GetBitsWithOrder(b, o, bitSize, bo.bo)
+	}
+	return GetBitsBitEndian(b, o, bitSize, order)
+}
+
+// setBits is SetBitsBitEndian which numbers bits in the bit order of order.
+func setBits(b []byte, o Offset, bits []Bit, order binary.ByteOrder) error {
+	if bo, ok := order.(bitOrdered); ok {
+		return SetBitsWithOrder(b, o, bits, bo.bo)
+	}
+	return SetBitsBitEndian(b, o, bits, order)
+}
+
+// bitMask returns the mask of the bit at off.Bit in bo numbering.
+func (bo BitOrder) bitMask(off Offset) byte {
+	if bo == MSB0 {
+		return 0x80 >> off.Bit
+	}
+	return 1 << off.Bit
+}
+
+// GetBitsWithOrder returns bitSize bits from Offset o.
+// ret[i] is the i-th bit from o. off.Bit is numbered in bo.
+//  e.g. b = []byte{0x40} and o = Offset{Bit: 1}.
+//    MSB0: 0x40 = 0100|0000 -> GetBitsWithOrder(b, o, 1, MSB0) returns []Bit{true}
+//                 0123 4567   ( bit number )
+//    LSB0: 0x40 = 0100|0000 -> GetBitsWithOrder(b, o, 1, LSB0) returns []Bit{false}
+//                 7654 3210   ( bit number )
+func GetBitsWithOrder(b []byte, o Offset, bitSize uint64, bo BitOrder) ([]Bit, error) {
+	o.Normalize()
+	if _, err := isInRange(b, o, bitSize); err != nil {
+		return []Bit{}, err
+	}
+	ret := make([]Bit, bitSize)
+	for i := range ret {
+		ret[i] = b[o.Byte]&bo.bitMask(o) != 0
+		o, _ = o.AddOffset(Offset{Bit: 1})
+	}
+	return ret, nil
+}
+
+// SetBitsWithOrder sets setBits on b from Offset o.
+// setBits[i] is set to the i-th bit from o. off.Bit is numbered in bo.
+func SetBitsWithOrder(b []byte, o Offset, setBits []Bit, bo BitOrder) error {
+	o.Normalize()
+	if _, err := isInRange(b, o, uint64(len(setBits))); err != nil {
+		return err
+	}
+	for _, v := range setBits {
+		if v {
+			b[o.Byte] |= bo.bitMask(o)
+		} else {
+			b[o.Byte] &^= bo.bitMask(o)
+		}
+		o, _ = o.AddOffset(Offset{Bit: 1})
+	}
+	return nil
+}
+
+// isBitArray returns true if v is array or slice of Bit.
+func isBitArray(v reflect.Value) bool {
+	return (v.Kind() == reflect.Array || v.Kind() == reflect.Slice) && v.Type().Elem().Kind() == reflect.Bool
+}
+
+// readBitArray reads bit array v in bo. v[i] is the i-th bit from o.
+func readBitArray(s *source, v reflect.Value, o *Offset, bo BitOrder) error {
+	var err error
+	if err := s.ensure(*o, uint64(v.Len())); err != nil {
+		return err
+	}
+	ret, err := GetBitsWithOrder(s.b, *o, uint64(v.Len()), bo)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < v.Len(); i++ {
+		if v.Index(i).CanSet() {
+			v.Index(i).SetBool(bool(ret[i]))
+		}
+	}
+	*o, err = o.AddOffset(Offset{Bit: uint64(v.Len())})
+	return err
+}
+
+// writeBitArray writes bit array v in bo.
+func writeBitArray(v reflect.Value, b []byte, o *Offset, bo BitOrder) error {
+	var err error
+	if !v.CanInterface() {
+		// skip unexported field
+		*o, err = o.AddOffset(Offset{Bit: uint64(v.Len())})
+		return err
+	}
+	bs := make([]Bit, v.Len())
+	for i := range bs {
+		bs[i] = Bit(v.Index(i).Bool())
+	}
+	if err := SetBitsWithOrder(b, *o, bs, bo); err != nil {
+		return err
+	}
+	*o, err = o.AddOffset(Offset{Bit: uint64(v.Len())})
+	return err
+}
+
+// reverseField reverses the bits of v in place.
+// Integer is reversed in bitSize bits. If bitSize is 0, it is the size of the type.
+// The order of elements is reversed if v is bit array.
+func reverseField(v reflect.Value, bitSize int) error {
+	if bitSize == 0 && isInteger(v.Type()) {
+		bitSize = v.Type().Bits()
+	}
+	switch v.Kind() {
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uint:
+		v.SetUint(bits.Reverse64(v.Uint()) >> uint(64-bitSize))
+		return nil
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Int:
+		raw := uint64(v.Int())
+		if bitSize < 64 {
+			raw &= 1<<uint(bitSize) - 1
+		}
+		v.SetInt(signExtend(bits.Reverse64(raw)>>uint(64-bitSize), bitSize))
+		return nil
+	}
+	if isBitArray(v) {
+		for i, j := 0, v.Len()-1; i < j; i, j = i+1, j-1 {
+			a, b := v.Index(i).Bool(), v.Index(j).Bool()
+			v.Index(i).SetBool(b)
+			v.Index(j).SetBool(a)
+		}
+		return nil
+	}
+	return fmt.Errorf("reverse is %w for %s", ErrUnsupportedType, v.Kind())
+}
+
+// isInteger returns true if t is int or uint type.
+func isInteger(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uint,
+		reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Int:
+		return true
+	}
+	return false
+}
+
+// canReverse returns true if `bit:"reverse"` is supported for t.
+func canReverse(t reflect.Type) bool {
+	return isInteger(t) || ((t.Kind() == reflect.Array || t.Kind() == reflect.Slice) && t.Elem().Kind() == reflect.Bool)
+}
+
+// reversed returns the copy of v which bits are reversed.
+func reversed(v reflect.Value, bitSize int) (reflect.Value, error) {
+	ret := reflect.New(v.Type()).Elem()
+	if v.Kind() == reflect.Slice {
+		ret.Set(reflect.MakeSlice(v.Type(), v.Len(), v.Len()))
+		reflect.Copy(ret, v)
+	} else {
+		ret.Set(v)
+	}
+	if err := reverseField(ret, bitSize); err != nil {
+		return reflect.Value{}, err
+	}
+	return ret, nil
+}
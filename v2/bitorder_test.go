@@ -0,0 +1,290 @@
+/*
+   Copyright 2020 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package bit_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"github.com/nokute78/go-bit/v2"
+	"reflect"
+	"testing"
+)
+
+func TestGetBitsWithOrder(t *testing.T) {
+	type testcase struct {
+		name    string
+		input   []byte
+		off     bit.Offset
+		bitSize uint64
+		order   bit.BitOrder
+		expect  []bit.Bit
+	}
+
+	cases := []testcase{
+		{"MSB0", []byte{0x40}, bit.Offset{Bit: 1}, 1, bit.MSB0, []bit.Bit{true}},
+		{"LSB0", []byte{0x40}, bit.Offset{Bit: 1}, 1, bit.LSB0, []bit.Bit{false}},
+		{"MSB0 cross byte", []byte{0x01, 0x80}, bit.Offset{Bit: 6}, 4, bit.MSB0, []bit.Bit{false, true, true, false}},
+		{"LSB0 cross byte", []byte{0x80, 0x01}, bit.Offset{Bit: 6}, 4, bit.LSB0, []bit.Bit{false, true, true, false}},
+	}
+
+	for _, v := range cases {
+		ret, err := bit.GetBitsWithOrder(v.input, v.off, v.bitSize, v.order)
+		if err != nil {
+			t.Errorf("%s: error:%s", v.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(ret, v.expect) {
+			t.Errorf("%s: given=%v expect=%v", v.name, ret, v.expect)
+		}
+
+		/* writing the bits back doesn't change the input */
+		b := append([]byte{}, v.input...)
+		if err := bit.SetBitsWithOrder(b, v.off, ret, v.order); err != nil {
+			t.Errorf("%s: SetBitsWithOrder error:%s", v.name, err)
+			continue
+		}
+		if !bytes.Equal(b, v.input) {
+			t.Errorf("%s: SetBitsWithOrder given=%x expect=%x", v.name, b, v.input)
+		}
+	}
+
+	b := []byte{0x00, 0x00}
+	if err := bit.SetBitsWithOrder(b, bit.Offset{Bit: 1}, []bit.Bit{true}, bit.MSB0); err != nil {
+		t.Fatalf("SetBitsWithOrder error:%s", err)
+	}
+	if err := bit.SetBitsWithOrder(b, bit.Offset{Byte: 1, Bit: 1}, []bit.Bit{true}, bit.LSB0); err != nil {
+		t.Fatalf("SetBitsWithOrder error:%s", err)
+	}
+	if !bytes.Equal(b, []byte{0x40, 0x02}) {
+		t.Errorf("SetBitsWithOrder: given=%x expect=4002", b)
+	}
+
+	if _, err := bit.GetBitsWithOrder([]byte{0x00}, bit.Offset{Bit: 4}, 5, bit.MSB0); err == nil {
+		t.Errorf("GetBitsWithOrder should fail for out of range")
+	}
+}
+
+func TestBitOrderTag(t *testing.T) {
+	/* MSB first fields in little endian struct */
+	type Msb struct {
+		A uint8  `bit:"bits=3,msb"`
+		B uint16 `bit:"bits=13,msb,BE"`
+		C uint8
+	}
+	type Be struct {
+		A uint8  `bit:"bits=3"`
+		B uint16 `bit:"bits=13"`
+		C uint8
+	}
+	input := []byte{0xb2, 0x34, 0x56}
+
+	var m Msb
+	var be Be
+	if err := bit.Read(bytes.NewReader(input), binary.LittleEndian, &m); err != nil {
+		t.Fatalf("bit.Read error:%s", err)
+	}
+	if err := bit.Read(bytes.NewReader(input), binary.BigEndian, &be); err != nil {
+		t.Fatalf("bit.Read error:%s", err)
+	}
+	if m.A != be.A || m.B != be.B || m.C != 0x56 {
+		t.Errorf("given=%+v expect=%+v", m, be)
+	}
+
+	b, _, err := bit.Marshal(m, binary.LittleEndian)
+	if err != nil {
+		t.Fatalf("bit.Marshal error:%s", err)
+	}
+	if !bytes.Equal(b, input) {
+		t.Errorf("bit.Marshal: given=%x expect=%x", b, input)
+	}
+}
+
+func TestBitOrderByteOrder(t *testing.T) {
+	/* msb/lsb changes the bit numbering, BE/LE of the struct is the byte order */
+	type Msb struct {
+		A uint16 `bit:"msb"`
+		B uint16 `bit:"bits=12,msb"`
+		C uint8  `bit:"bits=4,msb"`
+	}
+	type Lsb struct {
+		A uint16 `bit:"lsb"`
+		B uint16 `bit:"bits=12,lsb"`
+		C uint8  `bit:"bits=4,lsb"`
+	}
+	type Tag struct {
+		A uint16 `bit:"msb,LE"`
+		B uint16 `bit:"bits=12,LE,msb"`
+		C uint8  `bit:"bits=4,msb"`
+	}
+	type Flags struct {
+		F bit.Bit
+		G [3]bit.Bit
+		H uint8 `bit:"bits=4"`
+	}
+	type Nested struct {
+		A     uint16
+		Flags Flags `bit:"msb"`
+		B     uint8
+	}
+	input := []byte{0x12, 0x34, 0xab, 0xcd}
+
+	type testcase struct {
+		name   string
+		order  binary.ByteOrder
+		v      interface{}
+		expect interface{}
+	}
+	cases := []testcase{
+		{"msb,LE", binary.LittleEndian, &Msb{}, &Msb{A: 0x3412, B: 0xcab, C: 0xd}},
+		{"lsb,BE", binary.BigEndian, &Lsb{}, &Lsb{A: 0x1234, B: 0xabd, C: 0xc}},
+		{"tag", binary.BigEndian, &Tag{}, &Tag{A: 0x3412, B: 0xcab, C: 0xd}},
+		/* 0xab = 1010|1011 in MSB0 numbering */
+		{"nested", binary.LittleEndian, &Nested{}, &Nested{A: 0x3412, Flags: Flags{F: true, G: [3]bit.Bit{false, true, false}, H: 0xb}, B: 0xcd}},
+	}
+
+	for _, v := range cases {
+		if err := bit.Read(bytes.NewReader(input), v.order, v.v); err != nil {
+			t.Fatalf("%s: bit.Read error:%s", v.name, err)
+		}
+		if !reflect.DeepEqual(v.v, v.expect) {
+			t.Errorf("%s: given=%+v expect=%+v", v.name, v.v, v.expect)
+		}
+		b, _, err := bit.Marshal(v.v, v.order)
+		if err != nil {
+			t.Fatalf("%s: bit.Marshal error:%s", v.name, err)
+		}
+		if !bytes.Equal(b, input) {
+			t.Errorf("%s: bit.Marshal: given=%x expect=%x", v.name, b, input)
+		}
+	}
+}
+
+func TestBitOrderTagBitArray(t *testing.T) {
+	type S struct {
+		Msb [4]bit.Bit `bit:"msb"`
+		Lsb [4]bit.Bit `bit:"lsb"`
+	}
+	/* Msb is bit 0-3 in MSB0 numbering, Lsb is bit 4-7 in LSB0 numbering */
+	input := []byte{0x81}
+	expect := S{Msb: [4]bit.Bit{true, false, false, false}, Lsb: [4]bit.Bit{false, false, false, true}}
+
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		var s S
+		if err := bit.Read(bytes.NewReader(input), order, &s); err != nil {
+			t.Fatalf("%s: bit.Read error:%s", order, err)
+		}
+		if s != expect {
+			t.Errorf("%s: given=%+v expect=%+v", order, s, expect)
+		}
+	}
+}
+
+func TestBitOrderTagBitArrayBigEndian(t *testing.T) {
+	/* msb always has the i-th bit in the element i. untagged Bit array in BigEndian is read as integer. */
+	type S struct {
+		A [4]bit.Bit
+		B [4]bit.Bit `bit:"msb"`
+	}
+	input := []byte{0x8a}
+	expect := S{A: [4]bit.Bit{false, false, false, true}, B: [4]bit.Bit{true, false, true, false}}
+
+	var s S
+	if err := bit.Read(bytes.NewReader(input), binary.BigEndian, &s); err != nil {
+		t.Fatalf("bit.Read error:%s", err)
+	}
+	if s != expect {
+		t.Errorf("given=%+v expect=%+v", s, expect)
+	}
+	b, _, err := bit.Marshal(s, binary.BigEndian)
+	if err != nil {
+		t.Fatalf("bit.Marshal error:%s", err)
+	}
+	if !bytes.Equal(b, input) {
+		t.Errorf("bit.Marshal: given=%x expect=%x", b, input)
+	}
+}
+
+func TestReverseTag(t *testing.T) {
+	type S struct {
+		A uint8      `bit:"reverse"`
+		B uint8      `bit:"bits=4,reverse"`
+		C int8       `bit:"bits=4,reverse"`
+		D [4]bit.Bit `bit:"msb,reverse"`
+	}
+	input := []byte{0x01, 0x1e, 0x80}
+	expect := S{A: 0x80, B: 0x8, C: 7, D: [4]bit.Bit{false, false, false, true}}
+
+	var s S
+	if err := bit.Read(bytes.NewReader(input), binary.BigEndian, &s); err != nil {
+		t.Fatalf("bit.Read error:%s", err)
+	}
+	if s != expect {
+		t.Errorf("given=%+v expect=%+v", s, expect)
+	}
+
+	b, _, err := bit.Marshal(s, binary.BigEndian)
+	if err != nil {
+		t.Fatalf("bit.Marshal error:%s", err)
+	}
+	if !bytes.Equal(b, input) {
+		t.Errorf("bit.Marshal: given=%x expect=%x", b, input)
+	}
+	if s != expect {
+		t.Errorf("bit.Marshal changes the value: %+v", s)
+	}
+}
+
+func TestBitOrderTagInvalid(t *testing.T) {
+	type Str struct {
+		A string `bit:"str=1,reverse"`
+	}
+	type Float struct {
+		A float32 `bit:"reverse"`
+	}
+
+	type One struct {
+		A bit.Bit `bit:"reverse"`
+	}
+	type Sub struct {
+		A uint8
+	}
+	type Struct struct {
+		S Sub `bit:"reverse"`
+	}
+	type Ptr struct {
+		P *uint8 `bit:"reverse"`
+	}
+	type Plain struct {
+		A string `bit:"reverse"`
+	}
+
+	for _, v := range []interface{}{&Str{}, &Float{}, &One{}, &Struct{}, &Ptr{}, &Plain{}} {
+		if err := bit.Read(bytes.NewReader(make([]byte, 4)), binary.BigEndian, v); err == nil {
+			t.Errorf("%T: Read should fail", v)
+		}
+		if _, _, err := bit.Marshal(v, binary.BigEndian); err == nil {
+			t.Errorf("%T: Marshal should fail", v)
+		}
+	}
+	for _, v := range []interface{}{&One{}, &Struct{}, &Ptr{}, &Plain{}} {
+		_, err := bit.Unmarshal(make([]byte, 4), bit.Offset{}, binary.BigEndian, v)
+		if !errors.Is(err, bit.ErrUnsupportedType) {
+			t.Errorf("%T: errors.Is(err, ErrUnsupportedType) is false. err=%v", v, err)
+		}
+	}
+}
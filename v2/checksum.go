@@ -0,0 +1,289 @@
+/*
+   Copyright 2020 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package bit
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"strings"
+	"sync"
+)
+
+// ChecksumFunc returns the checksum of data.
+type ChecksumFunc func(data []byte) uint64
+
+var checksums = struct {
+	sync.RWMutex
+	m map[string]ChecksumFunc
+}{m: map[string]ChecksumFunc{
+	"crc8":         crc8,
+	"crc16-ccitt":  crc16CCITT,
+	"crc16-modbus": crc16Modbus,
+	"crc32":        func(data []byte) uint64 { return uint64(crc32.ChecksumIEEE(data)) },
+	"crc32c":       func(data []byte) uint64 { return uint64(crc32.Checksum(data, castagnoli)) },
+	"inet":         inetChecksum,
+	"sum8":         sum8,
+	"xor8":         xor8,
+}}
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// RegisterChecksum registers the checksum algorithm name.
+// The field which has `bit:"name=From..To"` or `bit:"checksum=name"` tag is computed by f.
+// The struct which uses name is planned again after RegisterChecksum,
+// so `bit:"name=Field"` becomes valid even if the struct is already used.
+// Built-in algorithms are crc8, crc16-ccitt, crc16-modbus, crc32, crc32c, inet, sum8 and xor8.
+// RegisterChecksum panics if name is empty or f is nil.
+func RegisterChecksum(name string, f ChecksumFunc) {
+	if name == "" || f == nil {
+		panic("bit: RegisterChecksum: name and f must not be empty")
+	}
+	checksums.Lock()
+	defer checksums.Unlock()
+	checksums.m[name] = f
+
+	/* "name=Field" tag may be rejected before name is registered */
+	plans.Range(func(k, _ interface{}) bool {
+		plans.Delete(k)
+		return true
+	})
+}
+
+func lookupChecksum(name string) (ChecksumFunc, bool) {
+	checksums.RLock()
+	defer checksums.RUnlock()
+	f, ok := checksums.m[name]
+	return f, ok
+}
+
+// crc8 is CRC-8/SMBUS. poly=0x07, init=0x00
+func crc8(data []byte) uint64 {
+	var crc byte
+	for _, b := range data {
+		crc ^= b
+		for i := 0; i < 8; i++ {
+			if crc&0x80 != 0 {
+				crc = crc<<1 ^ 0x07
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return uint64(crc)
+}
+
+// crc16CCITT is CRC-16/CCITT-FALSE. poly=0x1021, init=0xffff
+func crc16CCITT(data []byte) uint64 {
+	var crc uint16 = 0xffff
+	for _, b := range data {
+		crc ^= uint16(b) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return uint64(crc)
+}
+
+// crc16Modbus is CRC-16/MODBUS. poly=0x8005 (reflected), init=0xffff
+func crc16Modbus(data []byte) uint64 {
+	var crc uint16 = 0xffff
+	for _, b := range data {
+		crc ^= uint16(b)
+		for i := 0; i < 8; i++ {
+			if crc&1 != 0 {
+				crc = crc>>1 ^ 0xa001
+			} else {
+				crc >>= 1
+			}
+		}
+	}
+	return uint64(crc)
+}
+
+// inetChecksum is the internet checksum. RFC 1071
+func inetChecksum(data []byte) uint64 {
+	var sum uint32
+	for i := 0; i+1 < len(data); i += 2 {
+		sum += uint32(data[i])<<8 | uint32(data[i+1])
+	}
+	if len(data)%2 == 1 {
+		sum += uint32(data[len(data)-1]) << 8
+	}
+	for sum>>16 != 0 {
+		sum = sum&0xffff + sum>>16
+	}
+	return uint64(^uint16(sum))
+}
+
+func sum8(data []byte) uint64 {
+	var sum byte
+	for _, b := range data {
+		sum += b
+	}
+	return uint64(sum)
+}
+
+func xor8(data []byte) uint64 {
+	var x byte
+	for _, b := range data {
+		x ^= b
+	}
+	return uint64(x)
+}
+
+// checksumConfig represents "checksum=Name" and "Name=From..To" tags.
+//   "checksum=inet"          : the checksum of the preceding fields
+//   "crc16-ccitt=From..To"   : the checksum of the fields from From to To
+//   "crc32=Payload"          : the checksum of the field Payload
+// The field itself is treated as zero when it is in the range.
+type checksumConfig struct {
+	name string
+	from string /* empty means the first field */
+	to   string /* empty means the previous field */
+}
+
+func parseChecksumRange(name, s string) *checksumConfig {
+	ret := &checksumConfig{name: name}
+	if i := strings.Index(s, ".."); i >= 0 {
+		ret.from, ret.to = s[:i], s[i+2:]
+	} else {
+		ret.from, ret.to = s, s
+	}
+	return ret
+}
+
+func (c *checksumConfig) String() string {
+	return fmt.Sprintf("%s=%s..%s", c.name, c.from, c.to)
+}
+
+// fieldSpan is the range of the decoded/encoded field.
+type fieldSpan struct {
+	start, end Offset
+}
+
+// span returns the range of the checksum. index is the index of the checksum field.
+func (c *checksumConfig) span(p *typePlan, spans []fieldSpan, index int) (fieldSpan, error) {
+	from, to := 0, index-1
+	for i, fp := range p.fields {
+		if fp.name == c.from {
+			from = i
+		}
+		if fp.name == c.to {
+			to = i
+		}
+	}
+	if (c.from != "" && p.fields[from].name != c.from) || (c.to != "" && p.fields[to].name != c.to) {
+		return fieldSpan{}, fmt.Errorf("%s: field is not found", c)
+	}
+	if to < 0 || from > to {
+		return fieldSpan{}, fmt.Errorf("%s: invalid range", c)
+	}
+	ret := fieldSpan{start: spans[from].start, end: spans[to].end}
+	ret.start.Normalize()
+	ret.end.Normalize()
+	if ret.start.Bit != 0 || ret.end.Bit != 0 {
+		return fieldSpan{}, fmt.Errorf("%s: the range must be byte aligned", c)
+	}
+	return ret, nil
+}
+
+// compute returns the checksum of the range and the size of the checksum field in bits.
+func (c *checksumConfig) compute(b []byte, p *typePlan, spans []fieldSpan, index int) (uint64, int, error) {
+	f, ok := lookupChecksum(c.name)
+	if !ok {
+		return 0, 0, fmt.Errorf("checksum %s is not registered", c.name)
+	}
+	sp, err := c.span(p, spans, index)
+	if err != nil {
+		return 0, 0, err
+	}
+	if int(sp.end.Byte) > len(b) {
+		return 0, 0, ErrOutOfRange
+	}
+	data := make([]byte, sp.end.Byte-sp.start.Byte)
+	copy(data, b[sp.start.Byte:sp.end.Byte])
+
+	/* the checksum field is treated as zero */
+	self := spans[index]
+	size := int(self.end.Bits() - self.start.Bits())
+	if self.start.Bits() < sp.end.Bits() && self.end.Bits() > sp.start.Bits() {
+		rel := Offset{Bit: self.start.Bits() - sp.start.Bits()}
+		rel.Normalize()
+		if err := putUint(data, rel, 0, size, binary.BigEndian); err != nil {
+			return 0, 0, err
+		}
+	}
+	sum := f(data)
+	if size < 64 {
+		sum &= 1<<uint(size) - 1
+	}
+	return sum, size, nil
+}
+
+// verifyChecksums checks the checksum fields of v.
+func verifyChecksums(b []byte, order binary.ByteOrder, p *typePlan, spans []fieldSpan) error {
+	for i, fp := range p.fields {
+		if fp.cnf == nil || fp.cnf.checksum == nil || spans[i].start == spans[i].end {
+			continue
+		}
+		expect, size, err := fp.cnf.checksum.compute(b, p, spans, i)
+		if err != nil {
+			return decodeError(err, fp.name, spans[i].start, 0)
+		}
+		actual, err := getUint(b, spans[i].start, size, fp.cnf.order(order))
+		if err != nil {
+			return decodeError(err, fp.name, spans[i].start, size)
+		}
+		if actual != expect {
+			cerr := &ConstraintError{Field: fp.name, Offset: spans[i].start, Expect: expect, Actual: actual}
+			return decodeError(cerr, fp.name, spans[i].start, size)
+		}
+	}
+	return nil
+}
+
+// fillChecksums computes the checksum fields and overwrites them.
+func fillChecksums(b []byte, order binary.ByteOrder, p *typePlan, spans []fieldSpan) error {
+	for i, fp := range p.fields {
+		if fp.cnf == nil || fp.cnf.checksum == nil || spans[i].start == spans[i].end {
+			continue
+		}
+		sum, size, err := fp.cnf.checksum.compute(b, p, spans, i)
+		if err != nil {
+			return encodeError(err, fp.name, spans[i].start, 0)
+		}
+		if err := putUint(b, spans[i].start, sum, size, fp.cnf.order(order)); err != nil {
+			return encodeError(err, fp.name, spans[i].start, size)
+		}
+	}
+	return nil
+}
+
+// hasChecksum returns true if one of fields has checksum tag.
+func hasChecksum(fields []fieldPlan) bool {
+	for _, fp := range fields {
+		if fp.cnf != nil && fp.cnf.checksum != nil {
+			return true
+		}
+	}
+	return false
+}
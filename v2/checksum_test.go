@@ -0,0 +1,190 @@
+/*
+   Copyright 2020 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package bit_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"github.com/nokute78/go-bit/v2"
+	"testing"
+)
+
+func TestChecksumAlgorithms(t *testing.T) {
+	type S struct {
+		Data   [9]byte
+		CRC8   uint8  `bit:"crc8=Data"`
+		CCITT  uint16 `bit:"crc16-ccitt=Data"`
+		Modbus uint16 `bit:"crc16-modbus=Data"`
+		CRC32  uint32 `bit:"crc32=Data"`
+		CRC32C uint32 `bit:"crc32c=Data"`
+		Sum8   uint8  `bit:"sum8=Data"`
+		Xor8   uint8  `bit:"xor8=Data"`
+	}
+
+	in := S{}
+	copy(in.Data[:], "123456789")
+	b, _, err := bit.Marshal(in, binary.LittleEndian)
+	if err != nil {
+		t.Fatalf("bit.Marshal error:%s", err)
+	}
+
+	var out S
+	if _, err := bit.Unmarshal(b, bit.Offset{}, binary.LittleEndian, &out); err != nil {
+		t.Fatalf("bit.Unmarshal error:%s", err)
+	}
+	expect := S{Data: in.Data, CRC8: 0xf4, CCITT: 0x29b1, Modbus: 0x4b37,
+		CRC32: 0xcbf43926, CRC32C: 0xe3069283, Sum8: 0xdd, Xor8: 0x31}
+	if out != expect {
+		t.Errorf("mismatch\n given =%+v\n expect=%+v", out, expect)
+	}
+}
+
+type ipv4Header struct {
+	VerIHL   uint8
+	TOS      uint8
+	TotalLen uint16
+	ID       uint16
+	Flags    uint16
+	TTL      uint8
+	Proto    uint8
+	Checksum uint16 `bit:"inet=VerIHL..Dst"`
+	Src      uint32
+	Dst      uint32
+}
+
+var ipv4Sample = []byte{0x45, 0x00, 0x00, 0x73, 0x00, 0x00, 0x40, 0x00, 0x40, 0x11, 0xb8, 0x61,
+	0xc0, 0xa8, 0x00, 0x01, 0xc0, 0xa8, 0x00, 0xc7}
+
+func TestChecksumInet(t *testing.T) {
+	var h ipv4Header
+	if err := bit.Read(bytes.NewReader(ipv4Sample), binary.BigEndian, &h); err != nil {
+		t.Fatalf("bit.Read error:%s", err)
+	}
+	if h.Checksum != 0xb861 {
+		t.Errorf("Checksum: given=0x%x", h.Checksum)
+	}
+
+	/* Write fills the checksum */
+	h.Checksum = 0
+	b := new(bytes.Buffer)
+	if err := bit.Write(b, binary.BigEndian, h); err != nil {
+		t.Fatalf("bit.Write error:%s", err)
+	}
+	if !bytes.Equal(b.Bytes(), ipv4Sample) {
+		t.Errorf("mismatch\n given =%x\n expect=%x", b.Bytes(), ipv4Sample)
+	}
+}
+
+func TestChecksumMismatch(t *testing.T) {
+	input := append([]byte{}, ipv4Sample...)
+	input[8] = 0x3f /* TTL */
+
+	var h ipv4Header
+	err := bit.Read(bytes.NewReader(input), binary.BigEndian, &h)
+	var cerr *bit.ConstraintError
+	if !errors.As(err, &cerr) {
+		t.Fatalf("ConstraintError is not returned. err=%v", err)
+	}
+	if cerr.Field != "Checksum" || cerr.Offset != (bit.Offset{Byte: 10}) || cerr.Actual != 0xb861 {
+		t.Errorf("given=%+v", cerr)
+	}
+}
+
+func TestRegisterChecksum(t *testing.T) {
+	bit.RegisterChecksum("test-len", func(data []byte) uint64 {
+		return uint64(len(data))
+	})
+
+	type S struct {
+		A   uint16
+		B   uint8
+		Len uint8 `bit:"checksum=test-len"`
+	}
+	b, _, err := bit.Marshal(S{A: 1, B: 2}, binary.BigEndian)
+	if err != nil {
+		t.Fatalf("bit.Marshal error:%s", err)
+	}
+	expect := []byte{0x00, 0x01, 0x02, 0x03}
+	if !bytes.Equal(b, expect) {
+		t.Errorf("mismatch\n given =%x\n expect=%x", b, expect)
+	}
+}
+
+func TestRegisterChecksumLater(t *testing.T) {
+	type S struct {
+		A   uint16
+		Sum uint8 `bit:"test-later=A"`
+	}
+	type R struct {
+		A   uint16
+		Sum uint8 `bit:"test-later=A..A"`
+	}
+	if _, _, err := bit.Marshal(S{A: 0x0102}, binary.BigEndian); err == nil {
+		t.Errorf("S: Marshal should fail before RegisterChecksum")
+	}
+	if _, _, err := bit.Marshal(R{A: 0x0102}, binary.BigEndian); err == nil {
+		t.Errorf("R: Marshal should fail before RegisterChecksum")
+	}
+
+	bit.RegisterChecksum("test-later", func(data []byte) uint64 {
+		return uint64(data[0] + data[1])
+	})
+
+	expect := []byte{0x01, 0x02, 0x03}
+	for _, v := range []interface{}{S{A: 0x0102}, R{A: 0x0102}} {
+		b, _, err := bit.Marshal(v, binary.BigEndian)
+		if err != nil {
+			t.Fatalf("%T: bit.Marshal error:%s", v, err)
+		}
+		if !bytes.Equal(b, expect) {
+			t.Errorf("%T: mismatch\n given =%x\n expect=%x", v, b, expect)
+		}
+	}
+}
+
+func TestChecksumError(t *testing.T) {
+	type NotAligned struct {
+		A   uint8 `bit:"bits=4"`
+		Sum uint8 `bit:"checksum=sum8"`
+	}
+	type NotFound struct {
+		A   uint8
+		Sum uint8 `bit:"sum8=X..A"`
+	}
+	type Unknown struct {
+		A   uint8
+		Sum uint8 `bit:"checksum=unknown"`
+	}
+	type UnknownRange struct {
+		A   uint8
+		Sum uint8 `bit:"unknown=A..A"`
+	}
+	type Misspelled struct {
+		A   uint8
+		Sum uint8 `bit:"crc-8=A"`
+	}
+
+	for _, v := range []interface{}{&NotAligned{}, &NotFound{}, &Unknown{}, &UnknownRange{}, &Misspelled{}} {
+		if err := bit.Read(bytes.NewReader(make([]byte, 4)), binary.BigEndian, v); err == nil {
+			t.Errorf("%T: Read should fail", v)
+		}
+		if err := bit.Write(new(bytes.Buffer), binary.BigEndian, v); err == nil {
+			t.Errorf("%T: Write should fail", v)
+		}
+	}
+}
@@ -0,0 +1,493 @@
+/*
+   Copyright 2020 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const bitImportPath = "github.com/nokute78/go-bit/v2"
+
+type fieldKind int
+
+const (
+	kindOther fieldKind = iota // fallback to reflection
+	kindUint
+	kindInt
+	kindFloat32
+	kindFloat64
+	kindFloat16
+	kindBFloat16
+	kindBit
+	kindBitArray
+)
+
+// field is a struct field resolved from AST.
+type field struct {
+	name   string
+	goType string // type name used for conversion
+	kind   fieldKind
+	size   int // size in bits. -1 means unknown.
+	skip   bool
+	order  string // "BigEndian" or "LittleEndian"
+	bits   int
+}
+
+// readable reports whether the field can be accessed from generated code.
+func (f *field) readable() bool {
+	return f.name != "_" && ast.IsExported(f.name)
+}
+
+type generator struct {
+	files   []*ast.File
+	pkgName string
+	bitPkg  string
+	imports map[string]bool
+	buf     bytes.Buffer
+}
+
+func newGenerator(inputs []string, output string) (*generator, error) {
+	var paths []string
+	for _, in := range inputs {
+		info, err := os.Stat(in)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			paths = append(paths, in)
+			continue
+		}
+		matches, err := filepath.Glob(filepath.Join(in, "*.go"))
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range matches {
+			if strings.HasSuffix(m, "_test.go") || filepath.Clean(m) == filepath.Clean(output) {
+				continue
+			}
+			paths = append(paths, m)
+		}
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no Go files in %s", strings.Join(inputs, " "))
+	}
+	sort.Strings(paths)
+
+	g := &generator{bitPkg: "bit", imports: map[string]bool{}}
+	fset := token.NewFileSet()
+	for _, p := range paths {
+		f, err := parser.ParseFile(fset, p, nil, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+		if g.pkgName == "" {
+			g.pkgName = f.Name.Name
+		} else if g.pkgName != f.Name.Name {
+			return nil, fmt.Errorf("multiple packages: %s and %s", g.pkgName, f.Name.Name)
+		}
+		g.files = append(g.files, f)
+	}
+	return g, nil
+}
+
+// lookup finds the struct type and the local name of go-bit package in its file.
+func (g *generator) lookup(name string) (*ast.StructType, string, error) {
+	for _, f := range g.files {
+		for _, decl := range f.Decls {
+			gd, ok := decl.(*ast.GenDecl)
+			if !ok || gd.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range gd.Specs {
+				ts := spec.(*ast.TypeSpec)
+				if ts.Name.Name != name {
+					continue
+				}
+				st, ok := ts.Type.(*ast.StructType)
+				if !ok {
+					return nil, "", fmt.Errorf("%s is not a struct", name)
+				}
+				bitPkg := "bit"
+				for _, imp := range f.Imports {
+					if p, _ := strconv.Unquote(imp.Path.Value); p == bitImportPath && imp.Name != nil {
+						bitPkg = imp.Name.Name
+					}
+				}
+				return st, bitPkg, nil
+			}
+		}
+	}
+	return nil, "", fmt.Errorf("type %s is not found", name)
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&g.buf, format, args...)
+}
+
+// generate returns formatted source which has methods for types.
+func (g *generator) generate(args []string, types []string) ([]byte, error) {
+	var body bytes.Buffer
+	for _, name := range types {
+		st, bitPkg, err := g.lookup(name)
+		if err != nil {
+			return nil, err
+		}
+		g.bitPkg = bitPkg
+		fields, err := g.parseFields(name, st)
+		if err != nil {
+			return nil, err
+		}
+		g.buf.Reset()
+		g.genUnmarshal(name, fields)
+		g.genMarshal(name, fields)
+		g.genSize(name, fields)
+		body.Write(g.buf.Bytes())
+	}
+
+	g.buf.Reset()
+	g.printf("// Code generated by \"bitgen %s\"; DO NOT EDIT.\n\n", strings.Join(args[1:], " "))
+	g.printf("package %s\n\n", g.pkgName)
+	g.printf("import (\n")
+	for _, imp := range []string{"encoding/binary", "fmt", "math"} {
+		if g.imports[imp] {
+			g.printf("\t%q\n", imp)
+		}
+	}
+	g.printf("\n")
+	if g.bitPkg == "bit" {
+		g.printf("\t%q\n", bitImportPath)
+	} else {
+		g.printf("\t%s %q\n", g.bitPkg, bitImportPath)
+	}
+	g.printf(")\n")
+	g.buf.Write(body.Bytes())
+
+	src, err := format.Source(g.buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("format error: %s", err)
+	}
+	return src, nil
+}
+
+var basicTypes = map[string]struct {
+	kind fieldKind
+	size int
+}{
+	"uint8":   {kindUint, 8},
+	"byte":    {kindUint, 8},
+	"uint16":  {kindUint, 16},
+	"uint32":  {kindUint, 32},
+	"uint64":  {kindUint, 64},
+	"int8":    {kindInt, 8},
+	"int16":   {kindInt, 16},
+	"int32":   {kindInt, 32},
+	"int64":   {kindInt, 64},
+	"float32": {kindFloat32, 32},
+	"float64": {kindFloat64, 64},
+}
+
+func (g *generator) resolveType(expr ast.Expr) (string, fieldKind, int) {
+	switch t := expr.(type) {
+	case *ast.Ident:
+		if b, ok := basicTypes[t.Name]; ok {
+			return t.Name, b.kind, b.size
+		}
+	case *ast.SelectorExpr:
+		if x, ok := t.X.(*ast.Ident); ok && x.Name == g.bitPkg {
+			name := g.bitPkg + "." + t.Sel.Name
+			switch t.Sel.Name {
+			case "Bit":
+				return name, kindBit, 1
+			case "Float16":
+				return name, kindFloat16, 16
+			case "BFloat16":
+				return name, kindBFloat16, 16
+			}
+		}
+	case *ast.ArrayType:
+		lit, ok := t.Len.(*ast.BasicLit)
+		if !ok || lit.Kind != token.INT {
+			break
+		}
+		n, err := strconv.Atoi(lit.Value)
+		if err != nil || n <= 0 {
+			break
+		}
+		_, kind, size := g.resolveType(t.Elt)
+		if kind == kindBit && n <= 64 {
+			return "", kindBitArray, n
+		}
+		if size >= 0 {
+			// read by reflection, but the size is static.
+			return "", kindOther, size * n
+		}
+	}
+	return "", kindOther, -1
+}
+
+// parseTag parses `bit:"..."` tag. It returns false if the field is ignored.
+func parseTag(f *field, tag *ast.BasicLit) (bool, error) {
+	if tag == nil {
+		return true, nil
+	}
+	s, err := strconv.Unquote(tag.Value)
+	if err != nil {
+		return false, err
+	}
+	v, ok := reflect.StructTag(s).Lookup("bit")
+	if !ok {
+		return true, nil
+	}
+	for _, t := range strings.Split(v, ",") {
+		switch {
+		case t == "-":
+			return false, nil
+		case t == "skip":
+			f.skip = true
+		case t == "BE":
+			f.order = "BigEndian"
+		case t == "LE":
+			f.order = "LittleEndian"
+		case strings.HasPrefix(t, "bits="):
+			n, err := strconv.Atoi(strings.TrimPrefix(t, "bits="))
+			if err != nil || n <= 0 || n > 64 {
+				return false, fmt.Errorf("invalid tag %q", t)
+			}
+			f.bits = n
+		default:
+			return false, fmt.Errorf("tag %q is not supported", t)
+		}
+	}
+	return true, nil
+}
+
+func (g *generator) parseFields(typeName string, st *ast.StructType) ([]*field, error) {
+	var ret []*field
+	for _, af := range st.Fields.List {
+		goType, kind, size := g.resolveType(af.Type)
+		names := af.Names
+		if len(names) == 0 {
+			// embedded field
+			names = []*ast.Ident{{Name: types(af.Type)}}
+		}
+		for _, n := range names {
+			f := &field{name: n.Name, goType: goType, kind: kind, size: size}
+			use, err := parseTag(f, af.Tag)
+			if err != nil {
+				return nil, fmt.Errorf("%s.%s: %s", typeName, f.name, err)
+			}
+			if !use {
+				continue
+			}
+			if f.bits > 0 {
+				if f.kind != kindUint && f.kind != kindInt {
+					return nil, fmt.Errorf("%s.%s: bits= is supported only for integer", typeName, f.name)
+				}
+				if f.bits > f.size {
+					return nil, fmt.Errorf("%s.%s: bits=%d is larger than type size %d", typeName, f.name, f.bits, f.size)
+				}
+				f.size = f.bits
+			}
+			if !f.readable() {
+				f.skip = true
+				if f.size < 0 && f.name == "_" {
+					return nil, fmt.Errorf("%s.%s: size is unknown", typeName, f.name)
+				}
+			}
+			if f.order != "" {
+				g.imports["encoding/binary"] = true
+			}
+			ret = append(ret, f)
+		}
+	}
+	return ret, nil
+}
+
+// types returns type name of embedded field.
+func types(expr ast.Expr) string {
+	switch t := expr.(type) {
+	case *ast.StarExpr:
+		return types(t.X)
+	case *ast.SelectorExpr:
+		return t.Sel.Name
+	case *ast.Ident:
+		return t.Name
+	}
+	return "_"
+}
+
+func hasOrder(fields []*field) bool {
+	for _, f := range fields {
+		if f.order != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *generator) sizeExpr(f *field) string {
+	if f.size >= 0 {
+		return strconv.Itoa(f.size)
+	}
+	return fmt.Sprintf("%s.Size(s.%s)", g.bitPkg, f.name)
+}
+
+func (g *generator) genUnmarshal(name string, fields []*field) {
+	g.printf("\n// UnmarshalBits implements %s.BitUnmarshaler.\n", g.bitPkg)
+	g.printf("func (s *%s) UnmarshalBits(r *%s.Reader) error {\n", name, g.bitPkg)
+	if hasOrder(fields) {
+		g.printf("order := r.ByteOrder()\n")
+	}
+	for _, f := range fields {
+		if f.order != "" {
+			g.printf("r.SetByteOrder(binary.%s)\n", f.order)
+		}
+		g.readField(f)
+		if f.order != "" {
+			g.printf("r.SetByteOrder(order)\n")
+		}
+	}
+	g.printf("return nil\n}\n")
+}
+
+func (g *generator) readField(f *field) {
+	if f.skip {
+		g.printf("if err := r.Skip(%s); err != nil {\nreturn err\n}\n", g.sizeExpr(f))
+		return
+	}
+
+	var call, conv string
+	switch {
+	case f.bits > 0:
+		call = fmt.Sprintf("r.ReadBits(%d)", f.bits)
+		conv = fmt.Sprintf("%s(v)", f.goType)
+		if f.kind == kindInt {
+			sh := 64 - f.bits
+			conv = fmt.Sprintf("%s(int64(v<<%d) >> %d)", f.goType, sh, sh)
+			if f.goType == "int64" {
+				conv = fmt.Sprintf("int64(v<<%d) >> %d", sh, sh)
+			}
+		}
+	case f.kind == kindUint:
+		call = fmt.Sprintf("r.ReadUint%d()", f.size)
+		conv = "v"
+	case f.kind == kindInt:
+		call = fmt.Sprintf("r.ReadUint%d()", f.size)
+		conv = fmt.Sprintf("%s(v)", f.goType)
+	case f.kind == kindFloat32:
+		g.imports["math"] = true
+		call = "r.ReadUint32()"
+		conv = "math.Float32frombits(v)"
+	case f.kind == kindFloat64:
+		g.imports["math"] = true
+		call = "r.ReadUint64()"
+		conv = "math.Float64frombits(v)"
+	case f.kind == kindFloat16 || f.kind == kindBFloat16:
+		call = "r.ReadUint16()"
+		conv = fmt.Sprintf("%s(v)", f.goType)
+	case f.kind == kindBit:
+		call = "r.ReadBit()"
+		conv = "v"
+	case f.kind == kindBitArray:
+		g.printf("{\nv, err := r.ReadBits(%d)\nif err != nil {\nreturn err\n}\n", f.size)
+		g.printf("for i := range s.%s {\ns.%s[i] = v>>uint(i)&1 == 1\n}\n}\n", f.name, f.name)
+		return
+	default:
+		g.printf("if err := r.Read(&s.%s); err != nil {\nreturn err\n}\n", f.name)
+		return
+	}
+	g.printf("{\nv, err := %s\nif err != nil {\nreturn err\n}\ns.%s = %s\n}\n", call, f.name, conv)
+}
+
+func (g *generator) genMarshal(name string, fields []*field) {
+	g.printf("\n// MarshalBits implements %s.BitMarshaler.\n", g.bitPkg)
+	g.printf("func (s %s) MarshalBits(w *%s.Writer) error {\n", name, g.bitPkg)
+	if hasOrder(fields) {
+		g.printf("order := w.ByteOrder()\n")
+	}
+	for _, f := range fields {
+		if f.order != "" {
+			g.printf("w.SetByteOrder(binary.%s)\n", f.order)
+		}
+		g.writeField(f)
+		if f.order != "" {
+			g.printf("w.SetByteOrder(order)\n")
+		}
+	}
+	g.printf("return nil\n}\n")
+}
+
+func (g *generator) writeField(f *field) {
+	var call string
+	switch {
+	case f.skip:
+		call = fmt.Sprintf("w.Skip(%s)", g.sizeExpr(f))
+	case f.bits > 0 && f.kind == kindInt && f.bits < 64:
+		g.imports["fmt"] = true
+		min, max := -(int64(1) << uint(f.bits-1)), int64(1)<<uint(f.bits-1)-1
+		g.printf("{\nv := int64(s.%s)\n", f.name)
+		g.printf("if v < %d || v > %d {\nreturn fmt.Errorf(\"%s: %%d overflows %d bits\", v)\n}\n", min, max, f.name, f.bits)
+		g.printf("if err := w.WriteBits(uint64(v)&0x%x, %d); err != nil {\nreturn err\n}\n}\n", uint64(1)<<uint(f.bits)-1, f.bits)
+		return
+	case f.bits > 0:
+		call = fmt.Sprintf("w.WriteBits(uint64(s.%s), %d)", f.name, f.bits)
+	case f.kind == kindUint:
+		call = fmt.Sprintf("w.WriteUint%d(s.%s)", f.size, f.name)
+	case f.kind == kindInt, f.kind == kindFloat16, f.kind == kindBFloat16:
+		call = fmt.Sprintf("w.WriteUint%d(uint%d(s.%s))", f.size, f.size, f.name)
+	case f.kind == kindFloat32:
+		g.imports["math"] = true
+		call = fmt.Sprintf("w.WriteUint32(math.Float32bits(s.%s))", f.name)
+	case f.kind == kindFloat64:
+		g.imports["math"] = true
+		call = fmt.Sprintf("w.WriteUint64(math.Float64bits(s.%s))", f.name)
+	case f.kind == kindBit:
+		call = fmt.Sprintf("w.WriteBit(s.%s)", f.name)
+	case f.kind == kindBitArray:
+		g.printf("{\nvar v uint64\nfor i, b := range s.%s {\nif b {\nv |= 1 << uint(i)\n}\n}\n", f.name)
+		g.printf("if err := w.WriteBits(v, %d); err != nil {\nreturn err\n}\n}\n", f.size)
+		return
+	default:
+		call = fmt.Sprintf("w.Write(s.%s)", f.name)
+	}
+	g.printf("if err := %s; err != nil {\nreturn err\n}\n", call)
+}
+
+func (g *generator) genSize(name string, fields []*field) {
+	static := 0
+	var exprs []string
+	for _, f := range fields {
+		if f.size >= 0 {
+			static += f.size
+		} else {
+			exprs = append(exprs, g.sizeExpr(f))
+		}
+	}
+	g.printf("\n// BitSize implements %s.BitMarshaler.\n", g.bitPkg)
+	g.printf("func (s %s) BitSize() int {\nreturn %s\n}\n", name, strings.Join(append([]string{strconv.Itoa(static)}, exprs...), " + "))
+}
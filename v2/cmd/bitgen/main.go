@@ -0,0 +1,133 @@
+/*
+   Copyright 2020 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const version string = "0.0.1"
+
+// Exit status
+const (
+	ExitOK int = iota
+	ExitArgError
+	ExitCmdError
+)
+
+type config struct {
+	showVersion bool
+	types       []string
+	output      string
+	inputs      []string
+}
+
+// CLI has Out/Err streams.
+// Flags is option.
+type CLI struct {
+	OutStream io.Writer
+	ErrStream io.Writer
+	Flags     *flag.FlagSet
+}
+
+func (cli *CLI) checkOption(args []string) (*config, error) {
+	config := &config{}
+
+	cli.Flags = flag.NewFlagSet(filepath.Base(args[0]), flag.ExitOnError)
+
+	var types string
+	cli.Flags.BoolVar(&config.showVersion, "V", false, "show version")
+	cli.Flags.StringVar(&types, "type", "", "comma-separated list of type names (required)")
+	cli.Flags.StringVar(&config.output, "output", "", "output file name. \"-\" means stdout. (default <type>_bitgen.go)")
+
+	cli.Flags.Parse(args[1:])
+
+	if config.showVersion {
+		return config, nil
+	}
+
+	if types == "" {
+		return nil, fmt.Errorf("-type is not specified")
+	}
+	config.types = strings.Split(types, ",")
+
+	config.inputs = cli.Flags.Args()
+	if len(config.inputs) == 0 {
+		config.inputs = []string{"."}
+	}
+
+	if config.output == "" {
+		dir := config.inputs[0]
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			dir = filepath.Dir(dir)
+		}
+		name := strings.ToLower(config.types[0]) + "_bitgen.go"
+		if strings.HasSuffix(config.inputs[0], "_test.go") {
+			name = strings.ToLower(config.types[0]) + "_bitgen_test.go"
+		}
+		config.output = filepath.Join(dir, name)
+	}
+
+	return config, nil
+}
+
+// Run executes real main function.
+func (cli *CLI) Run(args []string) int {
+	cnf, err := cli.checkOption(args)
+	if err != nil {
+		fmt.Fprintf(cli.ErrStream, "Error:%s\n", err)
+		return ExitArgError
+	}
+
+	if cnf.showVersion {
+		fmt.Fprintf(cli.OutStream, "Ver: %s\n", version)
+		return ExitOK
+	}
+
+	g, err := newGenerator(cnf.inputs, cnf.output)
+	if err != nil {
+		fmt.Fprintf(cli.ErrStream, "Error:%s\n", err)
+		return ExitCmdError
+	}
+	src, err := g.generate(args, cnf.types)
+	if err != nil {
+		fmt.Fprintf(cli.ErrStream, "Error:%s\n", err)
+		return ExitCmdError
+	}
+
+	if cnf.output == "-" {
+		cli.OutStream.Write(src)
+		return ExitOK
+	}
+	if err := ioutil.WriteFile(cnf.output, src, 0644); err != nil {
+		fmt.Fprintf(cli.ErrStream, "Error:%s\n", err)
+		return ExitCmdError
+	}
+	return ExitOK
+}
+
+func main() {
+	cli := &CLI{OutStream: os.Stdout, ErrStream: os.Stderr}
+
+	os.Exit(cli.Run(os.Args))
+}
@@ -0,0 +1,144 @@
+/*
+   Copyright 2020 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func runHelper(cli *CLI, args []string, t *testing.T) {
+	t.Helper()
+
+	ret := cli.Run(args)
+
+	if ret != ExitOK {
+		t.Errorf("Return Code %d is not ExitOK", ret)
+	}
+}
+
+func writeSource(t *testing.T, src string) string {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "TestBitgen")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir error: %s", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "sample.go"), []byte(src), 0644); err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("ioutil.WriteFile error: %s", err)
+	}
+	return dir
+}
+
+const sampleSource = `package sample
+
+import gobit "github.com/nokute78/go-bit/v2"
+
+type Header struct {
+	Version uint8 ` + "`bit:\"bits=4\"`" + `
+	Flags   [4]gobit.Bit
+	Length  uint16 ` + "`bit:\"BE\"`" + `
+	Temp    int8   ` + "`bit:\"bits=6\"`" + `
+	_       uint8  ` + "`bit:\"bits=2\"`" + `
+	Ratio   gobit.Float16
+	Payload []byte ` + "`bit:\"-\"`" + `
+}
+`
+
+func TestGenerate(t *testing.T) {
+	dir := writeSource(t, sampleSource)
+	defer os.RemoveAll(dir)
+
+	outStream := new(bytes.Buffer)
+	cli := &CLI{OutStream: outStream, ErrStream: os.Stderr}
+	runHelper(cli, []string{"bitgen", "-type=Header", "-output=-", dir}, t)
+
+	out := outStream.String()
+	if _, err := parser.ParseFile(token.NewFileSet(), "out.go", out, 0); err != nil {
+		t.Fatalf("generated code is broken: %s\n%s", err, out)
+	}
+
+	for _, s := range []string{
+		"package sample",
+		`gobit "github.com/nokute78/go-bit/v2"`,
+		"func (s *Header) UnmarshalBits(r *gobit.Reader) error {",
+		"func (s Header) MarshalBits(w *gobit.Writer) error {",
+		"func (s Header) BitSize() int {\n\treturn 48\n}",
+		"r.SetByteOrder(binary.BigEndian)",
+		"s.Temp = int8(int64(v<<58) >> 58)",
+		"r.Skip(2)",
+	} {
+		if !strings.Contains(out, s) {
+			t.Errorf("%q is not found\n%s", s, out)
+		}
+	}
+	if strings.Contains(out, "Payload") {
+		t.Errorf("ignored field is generated\n%s", out)
+	}
+}
+
+func TestGenerateFile(t *testing.T) {
+	dir := writeSource(t, sampleSource)
+	defer os.RemoveAll(dir)
+
+	cli := &CLI{OutStream: new(bytes.Buffer), ErrStream: os.Stderr}
+	runHelper(cli, []string{"bitgen", "-type=Header", filepath.Join(dir, "sample.go")}, t)
+
+	if _, err := os.Stat(filepath.Join(dir, "header_bitgen.go")); err != nil {
+		t.Errorf("output file is not created: %s", err)
+	}
+}
+
+func TestGenerateError(t *testing.T) {
+	type testcase struct {
+		name string
+		src  string
+		args []string
+		ret  int
+	}
+	cases := []testcase{
+		{"no type", sampleSource, []string{"bitgen"}, ExitArgError},
+		{"unknown type", sampleSource, []string{"bitgen", "-type=Unknown"}, ExitCmdError},
+		{"not struct", "package sample\ntype Header int\n", []string{"bitgen", "-type=Header"}, ExitCmdError},
+		{"unsupported tag", "package sample\ntype Header struct {\nN uint8\nB []byte `bit:\"len=N\"`\n}\n",
+			[]string{"bitgen", "-type=Header"}, ExitCmdError},
+		{"bits on float", "package sample\ntype Header struct {\nF float32 `bit:\"bits=3\"`\n}\n",
+			[]string{"bitgen", "-type=Header"}, ExitCmdError},
+		{"bits too large", "package sample\ntype Header struct {\nF uint8 `bit:\"bits=9\"`\n}\n",
+			[]string{"bitgen", "-type=Header"}, ExitCmdError},
+	}
+
+	for _, v := range cases {
+		dir := writeSource(t, v.src)
+		cli := &CLI{OutStream: new(bytes.Buffer), ErrStream: new(bytes.Buffer)}
+		args := append(v.args, "-output=-", dir)
+		if v.args[len(v.args)-1] == "bitgen" {
+			args = v.args
+		}
+		if ret := cli.Run(args); ret != v.ret {
+			t.Errorf("%s: return code mismatch given=%d expect=%d", v.name, ret, v.ret)
+		}
+		os.RemoveAll(dir)
+	}
+}
@@ -0,0 +1,126 @@
+/*
+   Copyright 2020 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package bit
+
+import (
+	"fmt"
+	"github.com/goccy/go-reflect"
+	"strconv"
+	"strings"
+)
+
+// condition represents the expression of "if=" tag.
+//   "if=Name"           : the field Name is not zero
+//   "if=Name==1"        : compare the field Name with the value. ==, !=, <, <=, >, >= are supported.
+//   "if=Name&0x4"       : the field Name AND the value is not zero
+//   "if=Flags.HasExt"   : the field of nested struct
+type condition struct {
+	path  []string
+	op    string
+	value int64
+}
+
+// operators are sorted so that longer one is matched first.
+var condOperators = []string{"==", "!=", "<=", ">=", "<", ">", "&"}
+
+func parseCondition(s string) (*condition, error) {
+	ret := &condition{}
+	name := s
+	for _, op := range condOperators {
+		i := strings.Index(s, op)
+		if i < 0 {
+			continue
+		}
+		val, err := strconv.ParseInt(strings.TrimSpace(s[i+len(op):]), 0, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid condition %q", s)
+		}
+		name = s[:i]
+		ret.op = op
+		ret.value = val
+		break
+	}
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, fmt.Errorf("invalid condition %q", s)
+	}
+	ret.path = strings.Split(name, ".")
+	return ret, nil
+}
+
+// fieldByPath returns the field of v which is specified by dotted path.
+func fieldByPath(v reflect.Value, path []string) (reflect.Value, error) {
+	for _, name := range path {
+		v = reflect.Indirect(v)
+		if v.Kind() != reflect.Struct {
+			return reflect.Value{}, fmt.Errorf("%s is not struct", strings.Join(path, "."))
+		}
+		v = v.FieldByName(name)
+		if !v.IsValid() {
+			return reflect.Value{}, fmt.Errorf("field %s is not found", strings.Join(path, "."))
+		}
+	}
+	return v, nil
+}
+
+// intOf returns the value of f as int64.
+// Bool is treated as 1 or 0.
+func intOf(f reflect.Value) (int64, error) {
+	switch f.Kind() {
+	case reflect.Bool:
+		if f.Bool() {
+			return 1, nil
+		}
+		return 0, nil
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uint:
+		return int64(f.Uint()), nil
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Int:
+		return f.Int(), nil
+	}
+	return 0, fmt.Errorf("%w %s", ErrUnsupportedType, f.Kind())
+}
+
+// eval evaluates the condition against the fields of v.
+func (c *condition) eval(v reflect.Value) (bool, error) {
+	f, err := fieldByPath(v, c.path)
+	if err != nil {
+		return false, err
+	}
+
+	val, err := intOf(f)
+	if err != nil {
+		return false, fmt.Errorf("condition %s: %w", strings.Join(c.path, "."), err)
+	}
+
+	switch c.op {
+	case "==":
+		return val == c.value, nil
+	case "!=":
+		return val != c.value, nil
+	case "<":
+		return val < c.value, nil
+	case "<=":
+		return val <= c.value, nil
+	case ">":
+		return val > c.value, nil
+	case ">=":
+		return val >= c.value, nil
+	case "&":
+		return val&c.value != 0, nil
+	}
+	return val != 0, nil
+}
@@ -0,0 +1,137 @@
+/*
+   Copyright 2020 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package bit
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/goccy/go-reflect"
+	"strconv"
+)
+
+// ConstraintError is returned by Read when the field violates `bit:"const=V"` or `bit:"mbz"` tag.
+// It matches ErrConstraint by errors.Is.
+// It is wrapped by DecodeError which describes the field, so Error doesn't repeat Field and Offset.
+type ConstraintError struct {
+	Field  string /* the name of the field */
+	Offset Offset /* the offset of the field */
+	Expect uint64
+	Actual uint64
+}
+
+func (e *ConstraintError) Error() string {
+	return fmt.Sprintf("expect 0x%x, but 0x%x", e.Expect, e.Actual)
+}
+
+// constraint represents "const=V" and "mbz" tags.
+//   "const=V": the field must be V. e.g. magic number
+//   "mbz"    : the field must be zero
+type constraint struct {
+	value uint64
+}
+
+func parseConst(s string) (*constraint, error) {
+	if v, err := strconv.ParseUint(s, 0, 64); err == nil {
+		return &constraint{value: v}, nil
+	}
+	v, err := strconv.ParseInt(s, 0, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tag const=%s", s)
+	}
+	return &constraint{value: uint64(v)}, nil
+}
+
+// expect returns the raw bits of the constant value.
+func (c *constraint) expect(bitSize int) (uint64, error) {
+	if bitSize >= 64 {
+		return c.value, nil
+	}
+	val := c.value & (1<<uint(bitSize) - 1)
+	if val != c.value && signExtend(val, bitSize) != int64(c.value) {
+		return 0, fmt.Errorf("const=0x%x overflows %d bits", c.value, bitSize)
+	}
+	return val, nil
+}
+
+// verify checks bitSize bits from o. It doesn't update o.
+func (c *constraint) verify(s *source, order binary.ByteOrder, o Offset, bitSize int, name string) error {
+	if bitSize > 64 {
+		if c.value != 0 {
+			return fmt.Errorf("%s: const is %w for %d bits", name, ErrUnsupportedType, bitSize)
+		}
+		/* mbz. check per 64 bits */
+		for bitSize > 0 {
+			n := bitSize
+			if n > 64 {
+				n = 64
+			}
+			if err := c.verify(s, order, o, n, name); err != nil {
+				return err
+			}
+			o, _ = o.AddOffset(Offset{Bit: uint64(n)})
+			bitSize -= n
+		}
+		return nil
+	}
+
+	expect, err := c.expect(bitSize)
+	if err != nil {
+		return fmt.Errorf("%s: %s", name, err)
+	}
+	if err := s.ensure(o, uint64(bitSize)); err != nil {
+		return err
+	}
+	actual, err := getUint(s.b, o, bitSize, order)
+	if err != nil {
+		return err
+	}
+	if actual != expect {
+		return &ConstraintError{Field: name, Offset: o, Expect: expect, Actual: actual}
+	}
+	return nil
+}
+
+// put writes the constant value to b at o and updates o.
+func (c *constraint) put(b []byte, order binary.ByteOrder, o *Offset, bitSize int, name string) error {
+	for bitSize > 64 {
+		if c.value != 0 {
+			return fmt.Errorf("%s: const is %w for %d bits", name, ErrUnsupportedType, bitSize)
+		}
+		if err := writeUint(b, o, 0, 64, order); err != nil {
+			return err
+		}
+		bitSize -= 64
+	}
+	expect, err := c.expect(bitSize)
+	if err != nil {
+		return fmt.Errorf("%s: %s", name, err)
+	}
+	return writeUint(b, o, expect, bitSize, order)
+}
+
+// fieldSize returns the size of the field f in bits.
+func fieldSize(f reflect.Value, cnf *tagConfig) int {
+	if cnf != nil && cnf.str != nil {
+		return cnf.str.size(f)
+	}
+	if cnf != nil && cnf.bits > 0 {
+		return cnf.bits
+	}
+	var size int
+	sizeOfValueInBits(&size, f)
+	return size
+}
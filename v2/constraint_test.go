@@ -0,0 +1,112 @@
+/*
+   Copyright 2020 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package bit_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"github.com/nokute78/go-bit/v2"
+	"testing"
+)
+
+type pngHeader struct {
+	Magic  [8]byte `bit:"const=0x89504e470d0a1a0a"`
+	Length uint32
+	Type   uint32 `bit:"const=0x49484452"`
+	Flag   uint8  `bit:"bits=1"`
+	_      uint8  `bit:"bits=7,mbz"`
+}
+
+func TestReadConst(t *testing.T) {
+	input := []byte{0x89, 'P', 'N', 'G', '\r', '\n', 0x1a, '\n', 0, 0, 0, 0x0d, 'I', 'H', 'D', 'R', 0x80}
+
+	var h pngHeader
+	if err := bit.Read(bytes.NewReader(input), binary.BigEndian, &h); err != nil {
+		t.Fatalf("bit.Read error:%s", err)
+	}
+	if h.Length != 0x0d || h.Type != 0x49484452 || h.Flag != 1 {
+		t.Errorf("given=%+v", h)
+	}
+}
+
+func TestReadConstError(t *testing.T) {
+	type testcase struct {
+		name   string
+		input  []byte
+		field  string
+		offset bit.Offset
+		actual uint64
+	}
+
+	cases := []testcase{
+		{"magic", []byte{0x89, 'p', 'N', 'G', '\r', '\n', 0x1a, '\n', 0, 0, 0, 0x0d, 'I', 'H', 'D', 'R', 0x80},
+			"Magic", bit.Offset{}, 0x89704e470d0a1a0a},
+		{"type", []byte{0x89, 'P', 'N', 'G', '\r', '\n', 0x1a, '\n', 0, 0, 0, 0x0d, 'I', 'D', 'A', 'T', 0x80},
+			"Type", bit.Offset{Byte: 12}, 0x49444154},
+		{"mbz", []byte{0x89, 'P', 'N', 'G', '\r', '\n', 0x1a, '\n', 0, 0, 0, 0x0d, 'I', 'H', 'D', 'R', 0x81},
+			"_", bit.Offset{Byte: 16, Bit: 1}, 0x01},
+	}
+
+	for _, v := range cases {
+		var h pngHeader
+		err := bit.Read(bytes.NewReader(v.input), binary.BigEndian, &h)
+		var cerr *bit.ConstraintError
+		if !errors.As(err, &cerr) {
+			t.Errorf("%s: ConstraintError is not returned. err=%v", v.name, err)
+			continue
+		}
+		if cerr.Field != v.field || cerr.Offset != v.offset || cerr.Actual != v.actual {
+			t.Errorf("%s: given=%+v", v.name, cerr)
+		}
+	}
+}
+
+func TestWriteConst(t *testing.T) {
+	h := pngHeader{Length: 0x0d, Flag: 1}
+	expect := []byte{0x89, 'P', 'N', 'G', '\r', '\n', 0x1a, '\n', 0, 0, 0, 0x0d, 'I', 'H', 'D', 'R', 0x80}
+
+	b, _, err := bit.Marshal(h, binary.BigEndian)
+	if err != nil {
+		t.Fatalf("bit.Marshal error:%s", err)
+	}
+	if !bytes.Equal(b, expect) {
+		t.Errorf("mismatch\n given =%x\n expect=%x", b, expect)
+	}
+}
+
+func TestConstSigned(t *testing.T) {
+	type S struct {
+		A int8 `bit:"bits=4,const=-2"`
+		B int8 `bit:"bits=4,const=0x7"`
+	}
+	var s S
+	if err := bit.Read(bytes.NewReader([]byte{0xe7}), binary.BigEndian, &s); err != nil {
+		t.Fatalf("bit.Read error:%s", err)
+	}
+	if s.A != -2 || s.B != 7 {
+		t.Errorf("given=%+v", s)
+	}
+
+	type Overflow struct {
+		A uint8 `bit:"const=0x100"`
+	}
+	var o Overflow
+	if err := bit.Read(bytes.NewReader([]byte{0x00}), binary.BigEndian, &o); err == nil {
+		t.Errorf("Read should fail for overflow")
+	}
+}
@@ -22,109 +22,633 @@ import (
 	"fmt"
 	"github.com/goccy/go-reflect"
 	"io"
+	"math"
 )
 
 var errCannotInterface = errors.New("CanInterface returns false")
 
-// Size returns size of v in bits.
-/*
-func Size(v interface{}) int {
-	val := reflect.ValueOf(v)
-	var i int = 0
-	sizeOfValueInBits(&i, val, false)
-	return i
+// source holds bytes to be decoded.
+// If r is not nil, bytes are read from r on demand.
+type source struct {
+	b []byte
+	r io.Reader
+}
+
+// maxInt is the maximum value of int.
+const maxInt = int(^uint(0) >> 1)
+
+// ensureChunk is the maximum bytes which ensure reads at once.
+const ensureChunk = 64 * 1024
+
+// ensure reads bytes from s.r until s.b has bitSize bits from o.
+// The bytes are read in chunks, so a broken length in the input
+// fails with io.ErrUnexpectedEOF instead of allocating whole size.
+func (s *source) ensure(o Offset, bitSize uint64) error {
+	if s.r == nil {
+		return nil
+	}
+	need := (o.Bits() + bitSize + 7) / 8
+	for got := 0; uint64(len(s.b)) < need; {
+		size := need - uint64(len(s.b))
+		if size > ensureChunk {
+			size = ensureChunk
+		}
+		buf := make([]byte, size)
+		n, err := io.ReadFull(s.r, buf)
+		s.b = append(s.b, buf[:n]...)
+		if err == io.EOF && got > 0 {
+			err = io.ErrUnexpectedEOF
+		}
+		got += n
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rest returns the number of bits left in s.b from o.
+func (s *source) rest(o Offset) uint64 {
+	if o.Bits() >= uint64(len(s.b))*8 {
+		return 0
+	}
+	return uint64(len(s.b))*8 - o.Bits()
 }
-*/
 
-// This function will be panic if v doesn't support Bits function.
-// if structtag is true, the function respects struct tag.
-func sizeOfValueInBits(c *int, v reflect.Value, structtag bool) {
+// sizeOfValueInBits adds the size of v in bits to c.
+// It respects struct tag.
+func sizeOfValueInBits(c *int, v reflect.Value) {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			/* nil pointer is treated as the zero value if the size is fixed */
+			if size := planOf(v.Type().Elem()).size; size > 0 {
+				*c += size
+			}
+			return
+		}
+		sizeOfValueInBits(c, v.Elem())
+		return
+	}
+	if m, ok := asMarshaler(v); ok {
+		*c += m.BitSize()
+		return
+	}
+	p := planOf(v.Type())
+	if p.size >= 0 {
+		*c += p.size
+		return
+	}
+
 	switch v.Kind() {
 	case reflect.Struct:
-		if structtag {
-			for i := 0; i < v.Type().NumField(); i++ {
-				if !v.Field(i).CanInterface() {
-					continue
-				}
-				f := v.Type().Field(i)
-				cnf := parseStructTag(f.Tag)
-				if cnf != nil && cnf.ignore {
+		var pos, end int
+		for _, fp := range p.fields {
+			cnf := fp.cnf
+			if cnf != nil && cnf.ignore {
+				continue
+			} else if cnf != nil && cnf.cond != nil {
+				if ok, err := cnf.cond.eval(v); err == nil && !ok {
 					continue
 				}
-				sizeOfValueInBits(c, v.Field(i), structtag)
 			}
-		} else {
-			for i := 0; i < v.NumField(); i++ {
-				if v.Field(i).CanInterface() {
-					sizeOfValueInBits(c, v.Field(i), structtag)
+			pos = int(cnf.place(uint64(pos)))
+			var size int
+			switch {
+			case cnf != nil && cnf.str != nil:
+				size = cnf.str.size(v.Field(fp.index))
+			case cnf != nil && cnf.bits > 0:
+				size = cnf.bits
+			case !fp.exported:
+				if s := planOf(v.Field(fp.index).Type()).size; s > 0 {
+					size = s
 				}
+			default:
+				sizeOfValueInBits(&size, v.Field(fp.index))
+			}
+			pos += size
+			if pos > end {
+				end = pos
 			}
 		}
+		*c += end
 	case reflect.Array, reflect.Slice:
-		if v.Len() == 0 {
+		if size := planOf(v.Type().Elem()).size; size >= 0 {
+			*c += size * v.Len()
 			return
 		}
-		var elemSize int
-		sizeOfValueInBits(&elemSize, v.Index(0), structtag)
-		*c += (elemSize * v.Len())
-	case reflect.Bool:
-		*c += 1
+		for i := 0; i < v.Len(); i++ {
+			sizeOfValueInBits(c, v.Index(i))
+		}
+	case reflect.Interface:
+		if e, err := variantValue(v); err == nil {
+			sizeOfValueInBits(c, e)
+		}
+	}
+}
+
+// checkBitsField checks if v can be treated as bitSize bits integer.
+func checkBitsField(v reflect.Value, bitSize int) error {
+	switch v.Kind() {
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uint,
+		reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Int:
+		if bitSize > v.Type().Bits() {
+			return fmt.Errorf("bits=%d exceeds the size of %s", bitSize, v.Type())
+		}
+		return nil
+	}
+	return fmt.Errorf("bits=%d is %w for %s", bitSize, ErrUnsupportedType, v.Kind())
+}
+
+// getUint reads bitSize bits from b at o as unsigned integer.
+// The bits are numbered in the bit order of order, and the first bits are
+// the most significant if the byte order is BigEndian, the least significant otherwise.
+// It is same as GetBitsBitEndian, but it processes bits per byte.
+func getUint(b []byte, o Offset, bitSize int, order binary.ByteOrder) (uint64, error) {
+	if _, err := isInRange(b, o, uint64(bitSize)); err != nil {
+		return 0, err
+	}
+	msb := bitOrderOf(order) == MSB0
+	big := byteOrderOf(order) == binary.BigEndian
+	pos := o.Bits()
+	var ret uint64
+
+	for n := bitSize; n > 0; {
+		bitAddr := int(pos % 8)
+		size := 8 - bitAddr
+		if size > n {
+			size = n
+		}
+		var chunk uint64
+		if msb {
+			chunk = uint64(b[pos/8]>>uint(8-bitAddr-size)) & (1<<uint(size) - 1)
+		} else {
+			chunk = uint64(b[pos/8]>>uint(bitAddr)) & (1<<uint(size) - 1)
+		}
+		if big {
+			ret = ret<<uint(size) | chunk
+		} else {
+			ret |= chunk << uint(bitSize-n)
+		}
+		pos += uint64(size)
+		n -= size
+	}
+	return ret, nil
+}
+
+// getBytes returns byteSize bytes from b at o.
+// It is same as GetBitsAsByte with LittleEndian, but it doesn't copy if o is byte aligned.
+func getBytes(b []byte, o Offset, byteSize int) ([]byte, error) {
+	o.Normalize()
+	if o.Bit != 0 {
+		return GetBitsAsByte(b, o, uint64(byteSize*8), binary.LittleEndian)
+	}
+	if _, err := isInRange(b, o, uint64(byteSize*8)); err != nil {
+		return []byte{}, err
+	}
+	return b[o.Byte : o.Byte+uint64(byteSize)], nil
+}
+
+// signExtend treats the lower bitSize bits of val as two's complement.
+func signExtend(val uint64, bitSize int) int64 {
+	if bitSize < 64 && val&(1<<uint(bitSize-1)) != 0 {
+		val |= ^uint64(0) << uint(bitSize)
+	}
+	return int64(val)
+}
+
+// readUint reads bitSize bits from s at o as unsigned integer and advances o.
+func readUint(s *source, o *Offset, bitSize int, order binary.ByteOrder) (uint64, error) {
+	if err := s.ensure(*o, uint64(bitSize)); err != nil {
+		return 0, err
+	}
+	ret, err := getUint(s.b, *o, bitSize, order)
+	if err != nil {
+		return 0, err
+	}
+	*o, err = o.AddOffset(Offset{Bit: uint64(bitSize)})
+	return ret, err
+}
+
+// readBits reads bitSize bits from s and fill v.
+func readBits(s *source, order binary.ByteOrder, v reflect.Value, o *Offset, bitSize int) error {
+	var err error
+	if !v.CanSet() {
+		// skip unexported field
+		*o, err = o.AddOffset(Offset{Bit: uint64(bitSize)})
+		if err != nil {
+			return err
+		}
+		return errCannotInterface
+	}
+	if err := checkBitsField(v, bitSize); err != nil {
+		return err
+	}
+
+	if err := s.ensure(*o, uint64(bitSize)); err != nil {
+		return err
+	}
+	ret, err := getUint(s.b, *o, bitSize, order)
+	if err != nil {
+		return err
+	}
+	switch v.Kind() {
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Int:
+		v.SetInt(signExtend(ret, bitSize))
 	default:
-		/* int, uint, float familiy */
-		*c += v.Type().Bits()
+		v.SetUint(ret)
+	}
+
+	*o, err = o.AddOffset(Offset{Bit: uint64(bitSize)})
+	return err
+}
+
+// lengthOf returns the value of the field name in v.
+// It is used as the length of variable-length field.
+func lengthOf(v reflect.Value, name string) (int, error) {
+	f := v.FieldByName(name)
+	if !f.IsValid() {
+		return 0, fmt.Errorf("field %s is not found", name)
+	}
+	switch f.Kind() {
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uint:
+		if f.Uint() > uint64(maxInt) {
+			return 0, fmt.Errorf("field %s(%d) is too large", name, f.Uint())
+		}
+		return int(f.Uint()), nil
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Int:
+		if f.Int() < 0 {
+			return 0, fmt.Errorf("field %s is negative", name)
+		}
+		if uint64(f.Int()) > uint64(maxInt) {
+			return 0, fmt.Errorf("field %s(%d) is too large", name, f.Int())
+		}
+		return int(f.Int()), nil
+	}
+	return 0, fmt.Errorf("field %s is not integer", name)
+}
+
+// sliceLen returns the number of elements of the slice field f.
+// The length is given by len=Name or size=Name tag.
+func sliceLen(v reflect.Value, f reflect.Value, cnf *tagConfig) (int, error) {
+	if f.Kind() != reflect.Slice {
+		return 0, fmt.Errorf("len/size is %w for %s", ErrUnsupportedType, f.Kind())
+	}
+	if cnf.lenField != "" {
+		return lengthOf(v, cnf.lenField)
+	}
+
+	size, err := lengthOf(v, cnf.sizeField)
+	if err != nil {
+		return 0, err
+	}
+	if size > maxInt/8 {
+		return 0, fmt.Errorf("size=%s(%d byte) is too large", cnf.sizeField, size)
+	}
+	elemSize := planOf(f.Type().Elem()).size
+	if elemSize <= 0 || (size*8)%elemSize != 0 {
+		return 0, fmt.Errorf("size=%s(%d byte) is not multiple of the element size", cnf.sizeField, size)
+	}
+	return size * 8 / elemSize, nil
+}
+
+// readSlice reads n elements into the slice f.
+// n comes from the input, so the slice is not allocated until the bytes
+// for the elements are available. If the element size is not fixed,
+// the slice grows as each element is decoded. The element which has no bits is error.
+func readSlice(s *source, order binary.ByteOrder, f reflect.Value, o *Offset, n int, reverse bool) error {
+	elem := f.Type().Elem()
+	if size := planOf(elem).size; size > 0 {
+		if s.r != nil {
+			if uint64(n) > (^uint64(0)-o.Bits())/uint64(size) {
+				return fmt.Errorf("%d elements: %w", n, ErrOutOfRange)
+			}
+			if err := s.ensure(*o, uint64(n)*uint64(size)); err != nil {
+				return err
+			}
+		}
+		if uint64(n) > s.rest(*o)/uint64(size) {
+			return fmt.Errorf("%d elements of %d bits: %w", n, size, ErrOutOfRange)
+		}
+		f.Set(reflect.MakeSlice(f.Type(), n, n))
+		if elem.Kind() == reflect.Uint8 {
+			/* the payload is in wire order. it is not reversed even if order is BigEndian. */
+			ret, err := getBytes(s.b, *o, n)
+			if err != nil {
+				return err
+			}
+			for i := range ret {
+				f.Index(i).SetUint(uint64(ret[i]))
+			}
+			if *o, err = o.AddOffset(Offset{Byte: uint64(n)}); err != nil {
+				return err
+			}
+		} else if err := read(s, order, f, o); err != nil {
+			return err
+		}
+	} else {
+		f.Set(reflect.MakeSlice(f.Type(), 0, 0))
+		for i := 0; i < n; i++ {
+			start := *o
+			e := reflect.New(elem).Elem()
+			if err := read(s, order, e, o); err != nil && err != errCannotInterface {
+				return decodeError(err, fmt.Sprintf("[%d]", i), start, 0)
+			}
+			if *o == start {
+				/* n is not bounded by the input if the element has no bits */
+				return decodeError(fmt.Errorf("%s has no bits", elem), fmt.Sprintf("[%d]", i), start, 0)
+			}
+			f.Set(reflect.Append(f, e))
+		}
+	}
+	if reverse {
+		return reverseField(f, 0)
+	}
+	return nil
+}
+
+// readStruct reads from s and fill each field of v.
+func readStruct(s *source, order binary.ByteOrder, v reflect.Value, o *Offset) error {
+	p := planOf(v.Type())
+	if p.err != nil {
+		return decodeError(p.err.err, p.err.field, *o, 0)
+	}
+	/* the end of the struct. overlapped field by "at=" may move o backward. */
+	base, end := *o, *o
+	defer func() {
+		if end.Bits() > o.Bits() {
+			*o = end
+		}
+	}()
+
+	/* the range of each field to compute checksum */
+	var spans []fieldSpan
+	if p.checksum {
+		spans = make([]fieldSpan, len(p.fields))
+	}
+
+	for _, fp := range p.fields {
+		if o.Bits() > end.Bits() {
+			end = *o
+		}
+		if spans != nil {
+			if fp.index > 0 {
+				spans[fp.index-1].end = *o
+			}
+			spans[fp.index].start = *o
+		}
+		i := fp.index
+		cnf := fp.cnf
+		if cnf != nil {
+			/* struct tag is defined */
+			if cnf.ignore {
+				continue
+			}
+			if cnf.cond != nil {
+				ok, err := cnf.cond.eval(v)
+				if err != nil {
+					return decodeError(err, fp.name, *o, 0)
+				} else if !ok {
+					/* the field doesn't exist */
+					if v.Field(i).CanSet() {
+						v.Field(i).Set(reflect.Zero(v.Field(i).Type()))
+					}
+					continue
+				}
+			}
+			if err := cnf.moveTo(base, o); err != nil {
+				return decodeError(err, fp.name, *o, 0)
+			}
+			if spans != nil {
+				spans[fp.index].start = *o
+			}
+		}
+		start := *o
+		if err := readField(s, order, v, fp, o); err != nil && err != errCannotInterface {
+			return decodeError(err, fp.name, start, fp.staticSize(v.Field(i).Type(), nil))
+		}
+	}
+	if spans != nil {
+		spans[len(spans)-1].end = *o
+		if err := verifyChecksums(s.b, order, p, spans); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readField reads from s and fill the field fp of v.
+func readField(s *source, order binary.ByteOrder, v reflect.Value, fp fieldPlan, o *Offset) error {
+	f := v.Field(fp.index)
+	cnf := fp.cnf
+	if cnf == nil {
+		return read(s, order, f, o)
+	}
+
+	var err error
+	fieldOrder := cnf.order(order)
+	if cnf.constraint != nil {
+		if err := cnf.constraint.verify(s, fieldOrder, *o, fieldSize(f, cnf), fp.name); err != nil {
+			return err
+		}
+	}
+	if cnf.skip {
+		bitSize := fieldSize(f, cnf)
+		/* only updates offset. not fill. */
+		*o, err = o.AddOffset(Offset{Bit: uint64(bitSize)})
+		return err
+	}
+	if cnf.str != nil {
+		return readString(s, fieldOrder, f, o, cnf.str)
+	}
+	if cnf.scale != nil {
+		return readScaled(s, fieldOrder, f, o, cnf)
+	}
+	if cnf.fixed != nil {
+		return readFixed(s, fieldOrder, f, o, cnf.fixed)
+	}
+	if cnf.bits > 0 {
+		if err := readBits(s, fieldOrder, f, o, cnf.bits); err != nil {
+			return err
+		}
+		if cnf.reverse {
+			return reverseField(f, cnf.bits)
+		}
+		return nil
+	}
+	if cnf.bitOrder != nil && isBitArray(f) {
+		/* v[i] is the i-th bit in the bit order */
+		if err := readBitArray(s, f, o, *cnf.bitOrder); err != nil {
+			return err
+		}
+		if cnf.reverse && f.CanSet() {
+			return reverseField(f, 0)
+		}
+		return nil
+	}
+	if cnf.lenField != "" || cnf.sizeField != "" {
+		n, err := sliceLen(v, f, cnf)
+		if err != nil {
+			return err
+		}
+		if f.CanSet() {
+			return readSlice(s, fieldOrder, f, o, n, cnf.reverse)
+		}
+	}
+	if cnf.switchField != "" && f.CanSet() {
+		ptr, byPtr, err := newVariant(v, f, cnf.switchField)
+		if err != nil {
+			return err
+		}
+		if err := read(s, fieldOrder, ptr.Elem(), o); err != nil && err != errCannotInterface {
+			return err
+		}
+		if byPtr {
+			f.Set(ptr)
+		} else {
+			f.Set(ptr.Elem())
+		}
+		return nil
 	}
+	if err := read(s, fieldOrder, f, o); err != nil {
+		return err
+	}
+	if cnf.reverse {
+		return reverseField(f, 0)
+	}
+	return nil
 }
 
-// read reads from b and fill v.
-func read(b []byte, order binary.ByteOrder, v reflect.Value, o *Offset) error {
+// read reads from s and fill v.
+func read(s *source, order binary.ByteOrder, v reflect.Value, o *Offset) error {
 	var off Offset
 	var err error
 	var val reflect.Value
 
 	if !v.CanInterface() {
 		// skip unexported field
-		var size int
-		sizeOfValueInBits(&size, v, false)
+		size := planOf(v.Type()).size
+		if size < 0 {
+			size = 0
+		}
 		*o, err = o.AddOffset(Offset{Bit: uint64(size)})
 		if err != nil {
 			return err
 		}
 		return errCannotInterface
 	}
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			if !v.CanSet() {
+				return fmt.Errorf("nil pointer %s cannot be allocated", v.Type())
+			}
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return read(s, order, v.Elem(), o)
+	}
+	if u, ok := asUnmarshaler(v); ok {
+		return unmarshal(u, s, order, o)
+	}
+
+	switch v.Kind() {
+	case reflect.Struct, reflect.Array, reflect.Slice:
+	default:
+		var size int
+		sizeOfValueInBits(&size, v)
+		if err := s.ensure(*o, uint64(size)); err != nil {
+			return err
+		}
+	}
+	b := s.b
 	d := v.Interface()
 
 	switch d.(type) {
 	case uint8:
-		ret, err := GetBitsAsByte(b, *o, 8, binary.LittleEndian)
+		ret, err := getBytes(b, *o, 1)
 		if err != nil {
 			return err
 		}
 		val = reflect.ValueOf(ret[0])
 		off = Offset{1, 0}
 	case uint16:
-		ret, err := GetBitsAsByte(b, *o, 16, binary.LittleEndian)
+		ret, err := getBytes(b, *o, 2)
 		if err != nil {
 			return err
 		}
 		val = reflect.ValueOf(order.Uint16(ret))
 		off = Offset{2, 0}
 	case uint32:
-		ret, err := GetBitsAsByte(b, *o, 32, binary.LittleEndian)
+		ret, err := getBytes(b, *o, 4)
 		if err != nil {
 			return err
 		}
 		val = reflect.ValueOf(order.Uint32(ret))
 		off = Offset{4, 0}
 	case uint64:
-		ret, err := GetBitsAsByte(b, *o, 64, binary.LittleEndian)
+		ret, err := getBytes(b, *o, 8)
 		if err != nil {
 			return err
 		}
 		val = reflect.ValueOf(order.Uint64(ret))
 		off = Offset{8, 0}
+	case int8:
+		ret, err := getBytes(b, *o, 1)
+		if err != nil {
+			return err
+		}
+		val = reflect.ValueOf(int8(ret[0]))
+		off = Offset{1, 0}
+	case int16:
+		ret, err := getBytes(b, *o, 2)
+		if err != nil {
+			return err
+		}
+		val = reflect.ValueOf(int16(order.Uint16(ret)))
+		off = Offset{2, 0}
+	case int32:
+		ret, err := getBytes(b, *o, 4)
+		if err != nil {
+			return err
+		}
+		val = reflect.ValueOf(int32(order.Uint32(ret)))
+		off = Offset{4, 0}
+	case int64:
+		ret, err := getBytes(b, *o, 8)
+		if err != nil {
+			return err
+		}
+		val = reflect.ValueOf(int64(order.Uint64(ret)))
+		off = Offset{8, 0}
+	case float32:
+		ret, err := getBytes(b, *o, 4)
+		if err != nil {
+			return err
+		}
+		val = reflect.ValueOf(math.Float32frombits(order.Uint32(ret)))
+		off = Offset{4, 0}
+	case float64:
+		ret, err := getBytes(b, *o, 8)
+		if err != nil {
+			return err
+		}
+		val = reflect.ValueOf(math.Float64frombits(order.Uint64(ret)))
+		off = Offset{8, 0}
+	case Float16:
+		ret, err := getBytes(b, *o, 2)
+		if err != nil {
+			return err
+		}
+		val = reflect.ValueOf(Float16(order.Uint16(ret)))
+		off = Offset{2, 0}
+	case BFloat16:
+		ret, err := getBytes(b, *o, 2)
+		if err != nil {
+			return err
+		}
+		val = reflect.ValueOf(BFloat16(order.Uint16(ret)))
+		off = Offset{2, 0}
 
 	case Bit:
-		ret, err := GetBitsBitEndian(b, *o, 1, order)
+		ret, err := getBits(b, *o, 1, order)
 		if err != nil {
 			return err
 		}
@@ -136,12 +660,15 @@ func read(b []byte, order binary.ByteOrder, v reflect.Value, o *Offset) error {
 		off = Offset{0, 1}
 	default: /* other data types */
 		switch v.Kind() {
-		case reflect.Array:
+		case reflect.Array, reflect.Slice:
 			if v.Len() > 0 {
 				if v.Index(0).Kind() == reflect.Bool {
 					/* Bit array */
 					/* when order is Big Endian, we should read the entire bits at once */
-					ret, err := GetBitsBitEndian(b, *o, uint64(v.Len()), order)
+					if err := s.ensure(*o, uint64(v.Len())); err != nil {
+						return err
+					}
+					ret, err := getBits(s.b, *o, uint64(v.Len()), order)
 					if err != nil {
 						return err
 					}
@@ -157,13 +684,16 @@ func read(b []byte, order binary.ByteOrder, v reflect.Value, o *Offset) error {
 					}
 					return nil
 				} else if v.Index(0).Kind() == reflect.Uint8 {
-					ret, err := GetBitsAsByte(b, *o, uint64(v.Len()*8), binary.LittleEndian)
+					if err := s.ensure(*o, uint64(v.Len()*8)); err != nil {
+						return err
+					}
+					ret, err := GetBitsAsByte(s.b, *o, uint64(v.Len()*8), binary.LittleEndian)
 					if err != nil {
 						return err
 					}
 					for i := 0; i < v.Len(); i++ {
 						if v.Index(i).CanSet() {
-							if order == binary.BigEndian {
+							if byteOrderOf(order) == binary.BigEndian {
 								// workaround! binary.Read doesn't support []byte in BigEndian
 								v.Index(i).Set(reflect.ValueOf(ret[v.Len()-1-i]))
 							} else {
@@ -178,47 +708,20 @@ func read(b []byte, order binary.ByteOrder, v reflect.Value, o *Offset) error {
 					return nil
 				} else {
 					for i := 0; i < v.Len(); i++ {
-						err := read(b, order, v.Index(i), o)
+						start := *o
+						err := read(s, order, v.Index(i), o)
 						if err != nil && err != errCannotInterface {
-							return err
+							return decodeError(err, fmt.Sprintf("[%d]", i), start, planOf(v.Type().Elem()).size)
 						}
 					}
 					return nil
 				}
 			}
-		case reflect.Struct:
-			for i := 0; i < v.Type().NumField(); i++ {
-				f := v.Type().Field(i)
-				cnf := parseStructTag(f.Tag)
-				if cnf != nil {
-					/* struct tag is defined */
-					if cnf.ignore {
-						continue
-					} else if cnf.skip {
-						var bitSize int
-						/* only updates offset. not fill. */
-						sizeOfValueInBits(&bitSize, v.Field(i), true)
-						*o, err = o.AddOffset(Offset{Bit: uint64(bitSize)})
-						if err != nil {
-							return err
-						}
-						continue
-					} else if cnf.endian != nil {
-						err := read(b, cnf.endian, v.Field(i), o)
-						if err != nil && err != errCannotInterface {
-							return err
-						}
-						continue
-					}
-				}
-				err := read(b, order, v.Field(i), o)
-				if err != nil && err != errCannotInterface {
-					return err
-				}
-			}
 			return nil
+		case reflect.Struct:
+			return readStruct(s, order, v, o)
 		default:
-			return fmt.Errorf("Not Supported %s", v.Kind())
+			return fmt.Errorf("%w %s", ErrUnsupportedType, v.Kind())
 		}
 	}
 
@@ -226,7 +729,7 @@ func read(b []byte, order binary.ByteOrder, v reflect.Value, o *Offset) error {
 	if v.CanSet() {
 		v.Set(val)
 	} else {
-		return fmt.Errorf("can not set %v\n", v)
+		return fmt.Errorf("%s cannot be set", v.Type())
 	}
 	*o, err = o.AddOffset(off)
 	if err != nil {
@@ -239,29 +742,80 @@ func read(b []byte, order binary.ByteOrder, v reflect.Value, o *Offset) error {
 // Read reads structured binary data from i into data.
 // Data must be a pointer to a fixed-size value.
 // Not exported struct field is ignored.
+// Nil pointer field is allocated.
+// It returns *DecodeError which has the path of the field if the field can not be decoded.
 //   Supports StructTag.
 //       `bit:"skip"` : ignore the field. Skip X bits which is the size of the field. It is useful for reserved field.
 //       `bit:"-"`    : ignore the field. Offset is not changed.
+//       `bit:"bits=N"`: read N bits as integer. The field must be int or uint type.
+//                       Signed integer is sign extended.
+//       `bit:"len=Name"`: the slice has N elements. N is the value of the preceding field Name.
+//       `bit:"size=Name"`: the slice has N bytes. N is the value of the preceding field Name.
+//       `bit:"if=Cond"`: read the field only if Cond is true. e.g. `bit:"if=Flags.HasExt"`, `bit:"if=Type==2"`
+//       `bit:"switch=Name"`: read the interface field as the variant selected by the field Name. See RegisterVariant.
+//       `bit:"q=M.N"`: read M+N bits as signed fixed-point number which has N fractional bits.
+//                      The field must be float type.
+//       `bit:"uq=M.N"`: read M+N bits as unsigned fixed-point number.
+//       `bit:"scale=F,offset=F,min=F,max=F"`: read raw integer and convert it to raw*scale+offset.
+//                      The field must be float type. The size of raw integer is "bits=N" or the size of the field.
+//                      It returns error if the value is out of [min, max].
+//       `bit:"str=N"`: read N characters as string. Trailing NULs are trimmed.
+//       `bit:"cstr"`: read NUL terminated string.
+//       `bit:"pstr=N"`: read N bits length and the string which has the length.
+//       `bit:"charset=ascii7"`: the character of the string is 7 bits.
+//       `bit:"align=N"`: skip bits until the next multiple of N bits from the start of the struct.
+//       `bit:"pad=N"`: skip N bits before the field.
+//       `bit:"at=N"`: read the field at N bits from the start of the struct. `at=N.M` means N bytes and M bits.
+//       `bit:"const=V"`: the field must be V. It returns *ConstraintError if the field is not V.
+//       `bit:"mbz"`: the field must be zero.
+//       `bit:"checksum=Name"`: verify the checksum of the preceding fields. See RegisterChecksum.
+//       `bit:"Name=From..To"`: verify the checksum of the fields from From to To.
+//       `bit:"msb"`, `bit:"lsb"`: number the bits of the field MSB first or LSB first. The byte order is not changed. See BitOrder.
+//       `bit:"reverse"`: reverse the bits of the integer or Bit array field.
 func Read(r io.Reader, order binary.ByteOrder, data interface{}) error {
 	v := reflect.ValueOf(data)
 	switch v.Kind() {
 	case reflect.Ptr:
-		var c int = 0
-		sizeOfValueInBits(&c, reflect.Indirect(v), true)
+		if isDynamic(reflect.Indirect(v).Type()) {
+			/* the size is not fixed. read bytes on demand. */
+			err := read(&source{r: r}, order, reflect.Indirect(v), &Offset{})
+			if err != nil && err != errCannotInterface {
+				return decodeError(err, "", Offset{}, 0)
+			}
+			return nil
+		}
+		c := planOf(reflect.Indirect(v).Type()).size
 		byteSize := sizeOfBits(c)
 		barr := make([]byte, byteSize)
 		n, err := r.Read(barr)
 		if err != nil {
 			return err
 		} else if n != byteSize {
-			return fmt.Errorf("bit.Read:short read, expect=%d byte, read=%d byte", byteSize, n)
+			return fmt.Errorf("bit.Read:%w, expect=%d byte, read=%d byte", ErrShortBuffer, byteSize, n)
 		}
-		err = read(barr, order, reflect.Indirect(v), &Offset{})
-		if err != io.EOF && err != errCannotInterface {
-			return err
+		err = read(&source{b: barr}, order, reflect.Indirect(v), &Offset{})
+		if err != nil && err != io.EOF && err != errCannotInterface {
+			return decodeError(err, "", Offset{}, c)
 		}
 	default:
 		return binary.Read(r, order, data)
 	}
 	return nil
 }
+
+// Unmarshal decodes buf from Offset off and stores the result in the value pointed to by data.
+// It returns the offset next to the decoded value.
+// Unmarshal supports the same struct tags as Read.
+func Unmarshal(buf []byte, off Offset, order binary.ByteOrder, data interface{}) (Offset, error) {
+	v := reflect.ValueOf(data)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return off, fmt.Errorf("bit.Unmarshal: data must be a non-nil pointer")
+	}
+	off.Normalize()
+	start := off
+	err := read(&source{b: buf}, order, v.Elem(), &off)
+	if err != nil && err != errCannotInterface {
+		return off, decodeError(err, "", start, planOf(v.Elem().Type()).size)
+	}
+	return off, nil
+}
@@ -21,10 +21,10 @@ import (
 	"encoding/binary"
 	"github.com/nokute78/go-bit/v2"
 	"io"
+	"reflect"
 	"testing"
 )
 
-/*
 func TestDataSizeInBits(t *testing.T) {
 	type testcase struct {
 		name   string
@@ -57,7 +57,45 @@ func TestDataSizeInBits(t *testing.T) {
 		}
 	}
 }
-*/
+
+func TestSizeStructTag(t *testing.T) {
+	type S struct {
+		A uint8 `bit:"bits=3"`
+		B uint8 `bit:"-"`
+		C uint8 `bit:"skip"`
+		D int16 `bit:"bits=12"`
+		_ [5]bit.Bit
+	}
+	type V struct {
+		Len  uint8
+		Data []uint16 `bit:"len=Len"`
+	}
+
+	if i := bit.Size(S{}); i != 28 {
+		t.Errorf("S: given=%d expect=28", i)
+	}
+	if i, err := bit.SizeOf(reflect.TypeOf(S{})); err != nil || i != 28 {
+		t.Errorf("SizeOf(S): given=%d,%v expect=28", i, err)
+	}
+
+	if i := bit.Size(V{Data: []uint16{1, 2, 3}}); i != 56 {
+		t.Errorf("V: given=%d expect=56", i)
+	}
+	if _, err := bit.SizeOf(reflect.TypeOf(V{})); err == nil {
+		t.Errorf("SizeOf(V): error is not returned")
+	}
+
+	/* nil pointer is the zero value */
+	if i := bit.Size((*S)(nil)); i != 28 {
+		t.Errorf("nil S: given=%d expect=28", i)
+	}
+	if i := bit.Size((*V)(nil)); i != 0 {
+		t.Errorf("nil V: given=%d expect=0", i)
+	}
+	if i := bit.Size(nil); i != 0 {
+		t.Errorf("nil: given=%d expect=0", i)
+	}
+}
 
 func TestReadPrimitive(t *testing.T) {
 	// uint8
@@ -359,3 +397,498 @@ func TestUnexportedField(t *testing.T) {
 		}
 	}
 }
+
+func TestReadBitsTag(t *testing.T) {
+	type S struct {
+		A uint8  `bit:"bits=4"`
+		B uint16 `bit:"bits=12"`
+		C uint8
+	}
+
+	type testcase struct {
+		name   string
+		order  binary.ByteOrder
+		expect S
+	}
+
+	cases := []testcase{
+		{"LittleEndian", binary.LittleEndian, S{A: 0xa, B: 0xc35, C: 0x01}},
+		{"BigEndian", binary.BigEndian, S{A: 0x5, B: 0xac3, C: 0x01}},
+	}
+
+	for _, v := range cases {
+		var s S
+		br := bytes.NewReader([]byte{0x5a, 0xc3, 0x01})
+		if err := bit.Read(br, v.order, &s); err != nil {
+			t.Fatalf("%s: error:%s", v.name, err)
+		}
+		if s != v.expect {
+			t.Errorf("%s: given=%+v expect=%+v", v.name, s, v.expect)
+		}
+	}
+}
+
+func TestReadBitsTagTcpHeader(t *testing.T) {
+	type TcpHeader struct {
+		SrcPort    uint16
+		DstPort    uint16
+		SeqNo      uint32
+		AckNo      uint32
+		HeaderLen  uint8  `bit:"bits=4"`
+		Reserved   uint8  `bit:"skip,bits=3"`
+		Flags      uint16 `bit:"bits=9"`
+		WinSize    uint16
+		CheckSum   uint16
+		EmePointer uint16
+	}
+
+	s := TcpHeader{}
+	br := bytes.NewReader([]byte{0xd8, 0x65, 0x01, 0xbb, 0x4b, 0xe0, 0x76, 0xcd, 0x48, 0xc8, 0x70, 0x8f,
+		0x50, 0x10, 0x10, 0x18, 0x0e, 0xc1, 0x00, 0x00})
+	if err := bit.Read(br, binary.BigEndian, &s); err != nil {
+		t.Fatalf("error:%s", err)
+	}
+	if s.HeaderLen != 5 {
+		t.Errorf("HeaderLen:given=%d expect=5", s.HeaderLen)
+	}
+	if s.Flags != 0x10 {
+		t.Errorf("Flags:given=0x%x expect=0x10", s.Flags)
+	}
+	if s.WinSize != 0x1018 {
+		t.Errorf("WinSize:given=0x%x expect=0x1018", s.WinSize)
+	}
+}
+
+func TestReadBitsTagInvalid(t *testing.T) {
+	type S struct {
+		A uint8 `bit:"bits=9"`
+	}
+
+	var s S
+	br := bytes.NewReader([]byte{0xff, 0xff})
+	if err := bit.Read(br, binary.LittleEndian, &s); err == nil {
+		t.Errorf("error is not returned")
+	}
+}
+
+func TestReadSigned(t *testing.T) {
+	type S struct {
+		I8  int8
+		I16 int16
+		I32 int32
+		I64 int64
+	}
+
+	type testcase struct {
+		name   string
+		order  binary.ByteOrder
+		input  []byte
+		expect S
+	}
+
+	cases := []testcase{
+		{"LittleEndian", binary.LittleEndian,
+			[]byte{0xfe, 0xfd, 0xff, 0xfc, 0xff, 0xff, 0xff, 0xfb, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+			S{-2, -3, -4, -5}},
+		{"BigEndian", binary.BigEndian,
+			[]byte{0x80, 0x7f, 0xff, 0x00, 0x00, 0x00, 0x01, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xfe},
+			S{-128, 0x7fff, 1, -2}},
+	}
+
+	for _, v := range cases {
+		var s S
+		br := bytes.NewReader(v.input)
+		if err := bit.Read(br, v.order, &s); err != nil {
+			t.Fatalf("%s: error:%s", v.name, err)
+		}
+		if s != v.expect {
+			t.Errorf("%s: given=%+v expect=%+v", v.name, s, v.expect)
+		}
+	}
+}
+
+func TestReadSignedBitsTag(t *testing.T) {
+	type Telemetry struct {
+		Temp   int16 `bit:"bits=12"`
+		Status uint8 `bit:"bits=4"`
+	}
+
+	type testcase struct {
+		name   string
+		input  []byte
+		expect Telemetry
+	}
+
+	cases := []testcase{
+		{"negative", []byte{0xff, 0x65}, Telemetry{Temp: -10, Status: 0x5}},
+		{"positive", []byte{0x01, 0x93}, Telemetry{Temp: 25, Status: 0x3}},
+		{"min", []byte{0x80, 0x00}, Telemetry{Temp: -2048, Status: 0x0}},
+	}
+
+	for _, v := range cases {
+		var s Telemetry
+		br := bytes.NewReader(v.input)
+		if err := bit.Read(br, binary.BigEndian, &s); err != nil {
+			t.Fatalf("%s: error:%s", v.name, err)
+		}
+		if s != v.expect {
+			t.Errorf("%s: given=%+v expect=%+v", v.name, s, v.expect)
+		}
+	}
+}
+
+func TestReadFloat(t *testing.T) {
+	type S struct {
+		F32 float32
+		F64 float64
+		H   bit.Float16
+		BF  bit.BFloat16
+	}
+
+	type testcase struct {
+		name  string
+		order binary.ByteOrder
+		input []byte
+	}
+
+	expect := S{F32: 1.5, F64: -0.25, H: bit.NewFloat16(2), BF: bit.NewBFloat16(-1)}
+	cases := []testcase{
+		{"LittleEndian", binary.LittleEndian,
+			[]byte{0x00, 0x00, 0xc0, 0x3f, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xd0, 0xbf, 0x00, 0x40, 0x80, 0xbf}},
+		{"BigEndian", binary.BigEndian,
+			[]byte{0x3f, 0xc0, 0x00, 0x00, 0xbf, 0xd0, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x40, 0x00, 0xbf, 0x80}},
+	}
+
+	for _, v := range cases {
+		var s S
+		br := bytes.NewReader(v.input)
+		if err := bit.Read(br, v.order, &s); err != nil {
+			t.Fatalf("%s: error:%s", v.name, err)
+		}
+		if s != expect {
+			t.Errorf("%s: given=%+v expect=%+v", v.name, s, expect)
+		}
+	}
+}
+
+func TestReadVariableLength(t *testing.T) {
+	type S struct {
+		Count   uint8
+		Data    []uint16 `bit:"len=Count"`
+		Length  uint8
+		Payload []byte `bit:"size=Length"`
+		NBits   uint8
+		Flags   []bit.Bit `bit:"len=NBits"`
+		Pad     [4]bit.Bit
+		Tail    uint8
+	}
+
+	input := []byte{0x02, 0x01, 0x02, 0x03, 0x04, 0x03, 0xaa, 0xbb, 0xcc, 0x04, 0x35, 0x77, 0xff}
+	br := bytes.NewReader(input)
+	var s S
+	if err := bit.Read(br, binary.LittleEndian, &s); err != nil {
+		t.Fatalf("error:%s", err)
+	}
+
+	if len(s.Data) != 2 || s.Data[0] != 0x0201 || s.Data[1] != 0x0403 {
+		t.Errorf("Data: given=%x", s.Data)
+	}
+	if bytes.Compare(s.Payload, []byte{0xaa, 0xbb, 0xcc}) != 0 {
+		t.Errorf("Payload: given=%x", s.Payload)
+	}
+	expect := []bit.Bit{true, false, true, false}
+	if len(s.Flags) != len(expect) {
+		t.Fatalf("Flags: given=%v expect=%v", s.Flags, expect)
+	}
+	for i := range expect {
+		if s.Flags[i] != expect[i] {
+			t.Errorf("Flags: given=%v expect=%v", s.Flags, expect)
+			break
+		}
+	}
+	if s.Tail != 0x77 {
+		t.Errorf("Tail: given=0x%x expect=0x77", s.Tail)
+	}
+
+	// Read should not consume the following data
+	if br.Len() != 1 {
+		t.Errorf("remaining: given=%d expect=1", br.Len())
+	}
+}
+
+func TestReadVariableLengthBigEndian(t *testing.T) {
+	type S struct {
+		N    uint8
+		Data []byte `bit:"size=N"`
+		M    uint8
+		Tail []uint8 `bit:"len=M"`
+	}
+
+	input := []byte{0x03, 'a', 'b', 'c', 0x02, 'd', 'e'}
+	var s S
+	if err := bit.Read(bytes.NewReader(input), binary.BigEndian, &s); err != nil {
+		t.Fatalf("error:%s", err)
+	}
+	if string(s.Data) != "abc" || string(s.Tail) != "de" {
+		t.Errorf("given=%q %q expect=\"abc\" \"de\"", s.Data, s.Tail)
+	}
+
+	b, _, err := bit.Marshal(s, binary.BigEndian)
+	if err != nil {
+		t.Fatalf("bit.Marshal error:%s", err)
+	}
+	if !bytes.Equal(b, input) {
+		t.Errorf("bit.Marshal: given=%x expect=%x", b, input)
+	}
+}
+
+func TestReadVariableLengthStruct(t *testing.T) {
+	type Elem struct {
+		A uint8 `bit:"bits=4"`
+		B uint8 `bit:"bits=4"`
+	}
+	type S struct {
+		Size  uint16
+		Elems []Elem `bit:"size=Size"`
+	}
+
+	var s S
+	br := bytes.NewReader([]byte{0x00, 0x02, 0x12, 0x34})
+	if err := bit.Read(br, binary.BigEndian, &s); err != nil {
+		t.Fatalf("error:%s", err)
+	}
+	if len(s.Elems) != 2 {
+		t.Fatalf("len: given=%d expect=2", len(s.Elems))
+	}
+	if s.Elems[0] != (Elem{1, 2}) || s.Elems[1] != (Elem{3, 4}) {
+		t.Errorf("given=%+v", s.Elems)
+	}
+}
+
+func TestReadVariableLengthShort(t *testing.T) {
+	type S struct {
+		Count uint8
+		Data  []byte `bit:"len=Count"`
+	}
+
+	var s S
+	br := bytes.NewReader([]byte{0x04, 0x01, 0x02})
+	if err := bit.Read(br, binary.LittleEndian, &s); err == nil {
+		t.Errorf("error is not returned")
+	}
+}
+
+func TestReadVariableLengthHuge(t *testing.T) {
+	type S struct {
+		Count uint64
+		Data  []uint16 `bit:"len=Count"`
+	}
+	type Elem struct {
+		Len  uint8
+		Data []byte `bit:"len=Len"`
+	}
+	type D struct {
+		Count uint64
+		Elems []Elem `bit:"len=Count"`
+	}
+	type Z struct {
+		Size uint64
+		Data []byte `bit:"size=Size"`
+	}
+	type Empty struct {
+		Count uint64
+		Elems []struct{} `bit:"len=Count"`
+	}
+
+	type testcase struct {
+		name  string
+		input []byte
+		v     interface{}
+	}
+
+	cases := []testcase{
+		{"max uint64", []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01, 0x02}, &S{}},
+		{"1<<60", []byte{0x10, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x02}, &S{}},
+		{"dynamic elem", []byte{0x10, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x02}, &D{}},
+		{"size", []byte{0x10, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x02}, &Z{}},
+		{"empty elem", []byte{0x00, 0x00, 0x00, 0x00, 0xff, 0xff, 0xff, 0xff, 0x01, 0x02}, &Empty{}},
+	}
+
+	for _, v := range cases {
+		if _, err := bit.Unmarshal(v.input, bit.Offset{}, binary.BigEndian, v.v); err == nil {
+			t.Errorf("%s: Unmarshal: error is not returned", v.name)
+		}
+		if err := bit.Read(bytes.NewReader(v.input), binary.BigEndian, v.v); err == nil {
+			t.Errorf("%s: Read: error is not returned", v.name)
+		}
+	}
+}
+
+func TestReadCondition(t *testing.T) {
+	type Flags struct {
+		HasExt bit.Bit
+		Type   uint8 `bit:"bits=7"`
+	}
+	type S struct {
+		Flags Flags
+		Ext   uint16 `bit:"if=Flags.HasExt"`
+		Opt   uint8  `bit:"if=Flags.Type==2"`
+		Mask  uint8  `bit:"if=Flags.Type&0x40"`
+		Large uint8  `bit:"if=Flags.Type>=3"`
+		Trail uint8
+	}
+
+	type testcase struct {
+		name   string
+		input  []byte
+		expect S
+	}
+
+	cases := []testcase{
+		{"no ext", []byte{0x02, 0x11, 0x22},
+			S{Flags: Flags{false, 2}, Opt: 0x11, Trail: 0x22}},
+		{"ext", []byte{0x82, 0xaa, 0xbb, 0x11, 0x22},
+			S{Flags: Flags{true, 2}, Ext: 0xaabb, Opt: 0x11, Trail: 0x22}},
+		{"mask", []byte{0x40, 0x33, 0x44, 0x22},
+			S{Flags: Flags{false, 0x40}, Mask: 0x33, Large: 0x44, Trail: 0x22}},
+	}
+
+	for _, v := range cases {
+		var s S
+		br := bytes.NewReader(v.input)
+		if err := bit.Read(br, binary.BigEndian, &s); err != nil {
+			t.Fatalf("%s: error:%s", v.name, err)
+		}
+		if s != v.expect {
+			t.Errorf("%s: given=%+v expect=%+v", v.name, s, v.expect)
+		}
+		if br.Len() != 0 {
+			t.Errorf("%s: %d bytes remain", v.name, br.Len())
+		}
+	}
+}
+
+func TestReadConditionInvalid(t *testing.T) {
+	type S struct {
+		A uint8
+		B uint8 `bit:"if=C==1"`
+	}
+
+	var s S
+	if err := bit.Read(bytes.NewReader([]byte{0x01, 0x02}), binary.BigEndian, &s); err == nil {
+		t.Errorf("error is not returned")
+	}
+}
+
+func TestReadPointer(t *testing.T) {
+	type Sub struct {
+		HasExt bit.Bit
+		Type   uint8 `bit:"bits=7"`
+	}
+	type S struct {
+		Sub  *Sub
+		Ext  *uint16 `bit:"if=Sub.HasExt"`
+		Arr  *[2]uint16
+		Next **Sub
+	}
+
+	var s S
+	br := bytes.NewReader([]byte{0x82, 0x12, 0x34, 0x00, 0x01, 0x00, 0x02, 0x03})
+	if err := bit.Read(br, binary.BigEndian, &s); err != nil {
+		t.Fatalf("error:%s", err)
+	}
+	if s.Sub == nil || *s.Sub != (Sub{true, 2}) {
+		t.Errorf("Sub: given=%+v", s.Sub)
+	}
+	if s.Ext == nil || *s.Ext != 0x1234 {
+		t.Errorf("Ext: given=%v", s.Ext)
+	}
+	if s.Arr == nil || *s.Arr != [2]uint16{0x01, 0x02} {
+		t.Errorf("Arr: given=%v", s.Arr)
+	}
+	if s.Next == nil || *s.Next == nil || **s.Next != (Sub{false, 3}) {
+		t.Errorf("Next: given=%v", s.Next)
+	}
+
+	/* allocated pointer is reused */
+	sub := s.Sub
+	if _, err := bit.Unmarshal([]byte{0x01, 0x00, 0x0a, 0x00, 0x0b, 0x04}, bit.Offset{}, binary.BigEndian, &s); err != nil {
+		t.Fatalf("bit.Unmarshal error:%s", err)
+	}
+	if s.Sub != sub || *s.Sub != (Sub{false, 1}) {
+		t.Errorf("Sub: given=%+v", s.Sub)
+	}
+}
+
+func TestSizeOfPointer(t *testing.T) {
+	type Sub struct {
+		A uint16
+	}
+	type S struct {
+		Sub *Sub
+		Arr *[3]uint8
+	}
+	type Node struct {
+		Value uint8
+		Next  *Node
+	}
+
+	if size, err := bit.SizeOf(reflect.TypeOf(S{})); err != nil || size != 40 {
+		t.Errorf("SizeOf(S): given=%d err=%v", size, err)
+	}
+	if size := bit.Size(S{}); size != 40 {
+		t.Errorf("Size(S{}): given=%d expect=40", size)
+	}
+	if _, err := bit.SizeOf(reflect.TypeOf(Node{})); err == nil {
+		t.Errorf("SizeOf(Node) should fail")
+	}
+	if size := bit.Size(Node{Value: 1, Next: &Node{Value: 2}}); size != 16 {
+		t.Errorf("Size(Node): given=%d expect=16", size)
+	}
+}
+
+func TestUnmarshal(t *testing.T) {
+	type S struct {
+		A uint8  `bit:"bits=4"`
+		B uint16 `bit:"bits=12"`
+		C uint8
+	}
+
+	buf := []byte{0xff, 0xff, 0x5a, 0xc3, 0x01, 0xee}
+	var s S
+	next, err := bit.Unmarshal(buf, bit.Offset{Byte: 2}, binary.BigEndian, &s)
+	if err != nil {
+		t.Fatalf("error:%s", err)
+	}
+	expect := S{A: 0x5, B: 0xac3, C: 0x01}
+	if s != expect {
+		t.Errorf("given=%+v expect=%+v", s, expect)
+	}
+	if next.Compare(bit.Offset{Byte: 5}) != 0 {
+		t.Errorf("next: given=%s expect=%s", next, bit.Offset{Byte: 5})
+	}
+
+	// out of range
+	if _, err := bit.Unmarshal(buf, bit.Offset{Byte: 4}, binary.BigEndian, &s); err == nil {
+		t.Errorf("error is not returned")
+	}
+}
+
+func TestUnmarshalBitOffset(t *testing.T) {
+	type S struct {
+		A uint8 `bit:"bits=4"`
+		B uint8 `bit:"bits=4"`
+	}
+
+	var s S
+	next, err := bit.Unmarshal([]byte{0x12, 0x34}, bit.Offset{Bit: 4}, binary.BigEndian, &s)
+	if err != nil {
+		t.Fatalf("error:%s", err)
+	}
+	if s.A != 0x2 || s.B != 0x3 {
+		t.Errorf("given=%+v", s)
+	}
+	if next.Compare(bit.Offset{Byte: 1, Bit: 4}) != 0 {
+		t.Errorf("next: given=%s", next)
+	}
+}
@@ -0,0 +1,113 @@
+/*
+   Copyright 2020 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package bit
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/goccy/go-reflect"
+	"io"
+)
+
+// Decoder reads and decodes values from an input stream.
+// Unlike Read, Decoder keeps the bit offset between Decode calls.
+// So non-byte-aligned values can be decoded consecutively.
+type Decoder struct {
+	s     source
+	order binary.ByteOrder
+	off   Offset /* offset in s.b */
+	base  uint64 /* bits which are dropped from s.b */
+}
+
+// NewDecoder returns a new decoder that reads from r.
+// The decoder introduces its own buffering and may read data from r beyond the values requested.
+func NewDecoder(r io.Reader, order binary.ByteOrder) *Decoder {
+	return &Decoder{s: source{r: bufio.NewReader(r)}, order: order}
+}
+
+// Decode reads the next value from its input and stores it in the value pointed to by v.
+// Decode returns io.EOF if there is no more input,
+// and io.ErrUnexpectedEOF if the input ends in the middle of the value.
+// Other errors are returned as *DecodeError.
+func (d *Decoder) Decode(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("Decoder.Decode: v must be a non-nil pointer")
+	}
+	rv = rv.Elem()
+
+	off := d.off
+	if !isDynamic(rv.Type()) {
+		/* read entire value at once */
+		size := planOf(rv.Type()).size
+		if err := d.s.ensure(off, uint64(size)); err != nil {
+			return d.eofError(err)
+		}
+	}
+	err := read(&d.s, d.order, rv, &off)
+	if err != nil && err != errCannotInterface {
+		switch {
+		case errors.Is(err, io.EOF):
+			if off.Compare(d.off) != 0 {
+				return io.ErrUnexpectedEOF
+			}
+			return d.eofError(io.EOF)
+		case errors.Is(err, io.ErrUnexpectedEOF):
+			return io.ErrUnexpectedEOF
+		}
+		return d.decodeError(err, planOf(rv.Type()).size)
+	}
+	d.off = off
+
+	/* drop consumed bytes */
+	if d.off.Byte > 0 {
+		d.s.b = d.s.b[d.off.Byte:]
+		d.base += d.off.Byte * 8
+		d.off.Byte = 0
+	}
+	return nil
+}
+
+// eofError returns io.ErrUnexpectedEOF if err is io.EOF and some bytes are not consumed.
+// The remaining bits of the last byte are treated as padding.
+func (d *Decoder) eofError(err error) error {
+	if err == io.EOF && len(d.s.b) > sizeOfBits(int(d.off.Bits())) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// decodeError wraps err as *DecodeError.
+// The offset is converted to the offset from the beginning of the input.
+func (d *Decoder) decodeError(err error, size int) error {
+	err = decodeError(err, "", d.off, size)
+	if e, ok := err.(*DecodeError); ok {
+		e.Offset = Offset{Bit: d.base + e.Offset.Bits()}
+		e.Offset.Normalize()
+	}
+	return err
+}
+
+// Offset returns the offset from the beginning of the input.
+// It is the total size of the decoded values.
+func (d *Decoder) Offset() Offset {
+	ret := Offset{Bit: d.base + d.off.Bits()}
+	ret.Normalize()
+	return ret
+}
@@ -0,0 +1,102 @@
+/*
+   Copyright 2020 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package bit_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/nokute78/go-bit/v2"
+	"io"
+	"testing"
+)
+
+func TestDecoder(t *testing.T) {
+	type Record struct {
+		Val uint16 `bit:"bits=12"`
+	}
+
+	d := bit.NewDecoder(bytes.NewReader([]byte{0xab, 0xc1, 0x23}), binary.BigEndian)
+
+	expects := []uint16{0xabc, 0x123}
+	for i, v := range expects {
+		var r Record
+		if err := d.Decode(&r); err != nil {
+			t.Fatalf("%d: Decode error:%s", i, err)
+		}
+		if r.Val != v {
+			t.Errorf("%d: given=0x%x expect=0x%x", i, r.Val, v)
+		}
+		if off := d.Offset(); off.Bits() != uint64(12*(i+1)) {
+			t.Errorf("%d: Offset given=%s expect=%d bits", i, off, 12*(i+1))
+		}
+	}
+
+	var r Record
+	if err := d.Decode(&r); err != io.EOF {
+		t.Errorf("err given=%v expect=%v", err, io.EOF)
+	}
+}
+
+func TestDecoderVariableLength(t *testing.T) {
+	type Msg struct {
+		Len  uint8     `bit:"bits=4"`
+		Data []bit.Bit `bit:"len=Len"`
+	}
+
+	/* 0011_101|0_101_01111|1000_0000 */
+	d := bit.NewDecoder(bytes.NewReader([]byte{0x3a, 0xaf, 0x80}), binary.BigEndian)
+
+	expects := [][]bit.Bit{
+		{true, false, true},
+		{true, true, true, true, false},
+	}
+	for i, v := range expects {
+		var m Msg
+		if err := d.Decode(&m); err != nil {
+			t.Fatalf("%d: Decode error:%s", i, err)
+		}
+		if len(m.Data) != len(v) {
+			t.Fatalf("%d: given=%v expect=%v", i, m.Data, v)
+		}
+		for j := range v {
+			if m.Data[j] != v[j] {
+				t.Errorf("%d: given=%v expect=%v", i, m.Data, v)
+				break
+			}
+		}
+	}
+	if off := d.Offset(); off.Bits() != 16 {
+		t.Errorf("Offset given=%s expect=16 bits", off)
+	}
+
+	var m Msg
+	if err := d.Decode(&m); err != io.ErrUnexpectedEOF {
+		t.Errorf("err given=%v expect=%v", err, io.ErrUnexpectedEOF)
+	}
+}
+
+func TestDecoderUnexpectedEOF(t *testing.T) {
+	d := bit.NewDecoder(bytes.NewReader([]byte{0x01, 0x02, 0x03}), binary.LittleEndian)
+
+	var u16 uint16
+	if err := d.Decode(&u16); err != nil {
+		t.Fatalf("Decode error:%s", err)
+	}
+	if err := d.Decode(&u16); err != io.ErrUnexpectedEOF {
+		t.Errorf("err given=%v expect=%v", err, io.ErrUnexpectedEOF)
+	}
+}
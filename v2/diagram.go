@@ -0,0 +1,254 @@
+/*
+   Copyright 2020 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package bit
+
+import (
+	"fmt"
+	"html"
+	"strings"
+)
+
+// diagram is the bits of the struct assigned to the fields.
+type diagram struct {
+	width  int
+	owner  []int    /* the index of labels which owns the bit */
+	labels []string /* the label of the field or the padding */
+}
+
+// diagramSegment is the part of a field in a row.
+type diagramSegment struct {
+	owner int
+	col   int /* the first bit in the row */
+	size  int /* bits */
+	label bool
+}
+
+// newDiagram assigns each bit of v to the field.
+// Overlapped bits by "at=" are assigned to the preceding field.
+// The bits which no field has are padding.
+func newDiagram(v interface{}, width int) (*diagram, error) {
+	if width <= 0 {
+		return nil, fmt.Errorf("width must be positive. %d", width)
+	}
+	fields, err := Layout(v)
+	if err != nil {
+		return nil, err
+	}
+	d := &diagram{width: width}
+	for i, f := range fields {
+		if f.BitSize <= 0 || (i+1 < len(fields) && isChildPath(f.Path, fields[i+1].Path)) {
+			/* struct or array. the children follow. */
+			continue
+		}
+		end := int(f.Offset.Bits()) + f.BitSize
+		for len(d.owner) < end {
+			d.owner = append(d.owner, -1)
+		}
+		for b := int(f.Offset.Bits()); b < end; b++ {
+			if d.owner[b] < 0 {
+				d.owner[b] = len(d.labels)
+			}
+		}
+		d.labels = append(d.labels, diagramLabel(f))
+	}
+	/* the bits which no field has are padding */
+	pad := -1
+	for b := range d.owner {
+		switch {
+		case d.owner[b] >= 0:
+			pad = -1
+		case pad >= 0:
+			d.owner[b] = pad
+		default:
+			pad = len(d.labels)
+			d.owner[b] = pad
+			d.labels = append(d.labels, "Padding")
+		}
+	}
+	return d, nil
+}
+
+// diagramLabel returns the label of f. The reserved field is "Reserved".
+//   "Hdr.Opts[2].Len" -> "Len"
+//   "Hdr.Vals[2]"     -> "Vals[2]"
+func diagramLabel(f FieldInfo) string {
+	for _, t := range f.Tags {
+		if t == "skip" {
+			return "Reserved"
+		}
+	}
+	names := splitPath(f.Path)
+	name := names[len(names)-1]
+	if strings.HasPrefix(name, "[") && len(names) > 1 {
+		name = names[len(names)-2] + name
+	}
+	if name == "_" {
+		return "Reserved"
+	}
+	return name
+}
+
+func (d *diagram) rows() int {
+	return (len(d.owner) + d.width - 1) / d.width
+}
+
+// at returns the owner of the bit at row r and column c. It returns -1 if the bit is out of v.
+func (d *diagram) at(r, c int) int {
+	b := r*d.width + c
+	if r < 0 || c >= d.width || b >= len(d.owner) {
+		return -1
+	}
+	return d.owner[b]
+}
+
+// segments returns the fields in row r.
+// The label is shown in the first segment of the field.
+func (d *diagram) segments(r int, labeled map[int]bool) []diagramSegment {
+	var ret []diagramSegment
+	for c := 0; c < d.width && d.at(r, c) >= 0; c++ {
+		o := d.at(r, c)
+		if n := len(ret); n > 0 && ret[n-1].owner == o {
+			ret[n-1].size++
+			continue
+		}
+		ret = append(ret, diagramSegment{owner: o, col: c, size: 1, label: !labeled[o]})
+		labeled[o] = true
+	}
+	return ret
+}
+
+// Diagram renders the layout of v as RFC 791 style ASCII art which has width bits per row.
+// The layout is computed by Layout. The bits out of the fields are shown as "Padding".
+//    0                   1
+//    0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5
+//   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//   |Version|  IHL  |Reserved | Len |
+//   +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+func Diagram(v interface{}, width int) (string, error) {
+	d, err := newDiagram(v, width)
+	if err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+
+	/* bit numbers */
+	tens, ones := make([]byte, 2*width), make([]byte, 2*width)
+	for c := 0; c < width; c++ {
+		tens[2*c], ones[2*c] = ' ', ' '
+		tens[2*c+1], ones[2*c+1] = ' ', byte('0'+c%10)
+		if c%10 == 0 {
+			tens[2*c+1] = byte('0' + c/10%10)
+		}
+	}
+	sb.WriteString(strings.TrimRight(string(tens), " ") + "\n")
+	sb.WriteString(string(ones) + "\n")
+
+	labeled := map[int]bool{}
+	for r := 0; r <= d.rows(); r++ {
+		sb.WriteString(d.border(r) + "\n")
+		if r == d.rows() {
+			break
+		}
+		sb.WriteString("|")
+		for _, s := range d.segments(r, labeled) {
+			label := ""
+			if s.label {
+				label = d.labels[s.owner]
+			}
+			sb.WriteString(center(label, 2*s.size-1) + "|")
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String(), nil
+}
+
+// border returns the line above row r.
+// The line is not drawn inside the field which continues from the previous row.
+func (d *diagram) border(r int) string {
+	cols := 0
+	for c := 0; c < d.width; c++ {
+		if d.at(r-1, c) >= 0 || d.at(r, c) >= 0 {
+			cols = c + 1
+		}
+	}
+	cont := func(c int) bool {
+		return c >= 0 && c < cols && d.at(r-1, c) >= 0 && d.at(r-1, c) == d.at(r, c)
+	}
+	line := make([]byte, 2*cols+1)
+	for c := 0; c <= cols; c++ {
+		switch {
+		case cont(c-1) && cont(c) && d.at(r, c-1) == d.at(r, c):
+			line[2*c] = ' '
+		case (c == 0 && cont(c)) || (c == cols && cont(c-1)):
+			line[2*c] = '|'
+		default:
+			line[2*c] = '+'
+		}
+		if c < cols {
+			line[2*c+1] = '-'
+			if cont(c) {
+				line[2*c+1] = ' '
+			}
+		}
+	}
+	return string(line)
+}
+
+// center returns s which is centered in n characters. s is truncated if it is longer than n.
+func center(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	left := (n - len(s)) / 2
+	return strings.Repeat(" ", left) + s + strings.Repeat(" ", n-len(s)-left)
+}
+
+const (
+	svgBitWidth  = 20 /* px */
+	svgRowHeight = 32 /* px */
+)
+
+// DiagramSVG renders the layout of v as SVG which has width bits per row. See Diagram.
+func DiagramSVG(v interface{}, width int) (string, error) {
+	d, err := newDiagram(v, width)
+	if err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	w, h := width*svgBitWidth+2, (d.rows()+1)*svgRowHeight+1
+	fmt.Fprintf(&sb, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="-1 0 %d %d" font-family="monospace" font-size="12">`+"\n", w, h, w, h)
+
+	/* bit numbers */
+	for c := 0; c < width; c++ {
+		fmt.Fprintf(&sb, `<text x="%d" y="%d" text-anchor="middle">%d</text>`+"\n", c*svgBitWidth+svgBitWidth/2, svgRowHeight-8, c)
+	}
+
+	labeled := map[int]bool{}
+	for r := 0; r < d.rows(); r++ {
+		y := (r + 1) * svgRowHeight
+		for _, s := range d.segments(r, labeled) {
+			x, sw := s.col*svgBitWidth, s.size*svgBitWidth
+			fmt.Fprintf(&sb, `<rect x="%d" y="%d" width="%d" height="%d" fill="none" stroke="black"/>`+"\n", x, y, sw, svgRowHeight)
+			if s.label {
+				fmt.Fprintf(&sb, `<text x="%d" y="%d" text-anchor="middle" dominant-baseline="middle">%s</text>`+"\n",
+					x+sw/2, y+svgRowHeight/2, html.EscapeString(d.labels[s.owner]))
+			}
+		}
+	}
+	sb.WriteString("</svg>\n")
+	return sb.String(), nil
+}
@@ -0,0 +1,124 @@
+/*
+   Copyright 2020 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package bit_test
+
+import (
+	"fmt"
+	"github.com/nokute78/go-bit/v2"
+	"strings"
+	"testing"
+)
+
+func ExampleDiagram() {
+	type Header struct {
+		Version uint8 `bit:"bits=4"`
+		IHL     uint8 `bit:"bits=4"`
+		TOS     uint8
+		Length  uint16
+		Flags   uint8  `bit:"bits=3"`
+		FragOff uint16 `bit:"bits=13"`
+		ID      uint16
+		Src     uint32
+	}
+
+	s, err := bit.Diagram(Header{}, 32)
+	if err != nil {
+		fmt.Printf("error:%s\n", err)
+	}
+	fmt.Print(s)
+	// Output:
+	//  0                   1                   2                   3
+	//  0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
+	// +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+	// |Version|  IHL  |      TOS      |            Length             |
+	// +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+	// |Flags|         FragOff         |              ID               |
+	// +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+	// |                              Src                              |
+	// +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+}
+
+func TestDiagram(t *testing.T) {
+	type S struct {
+		A     uint8 `bit:"bits=4"`
+		_     uint8 `bit:"bits=2"`
+		R     uint8 `bit:"skip,bits=2"`
+		B     uint8 `bit:"pad=4,bits=4"`
+		Stamp uint32
+		Vals  [2]struct {
+			V uint8 `bit:"bits=4"`
+		}
+		Empty []uint8
+	}
+
+	s, err := bit.Diagram(S{}, 8)
+	if err != nil {
+		t.Fatalf("Diagram error:%s", err)
+	}
+	expect := strings.Join([]string{
+		" 0",
+		" 0 1 2 3 4 5 6 7",
+		"+-+-+-+-+-+-+-+-+",
+		"|   A   |Res|Res|",
+		"+-+-+-+-+-+-+-+-+",
+		"|Padding|   B   |",
+		"+-+-+-+-+-+-+-+-+",
+		"|     Stamp     |",
+		"|               |",
+		"|               |",
+		"|               |",
+		"|               |",
+		"|               |",
+		"|               |",
+		"+-+-+-+-+-+-+-+-+",
+		"|   V   |   V   |",
+		"+-+-+-+-+-+-+-+-+",
+		"",
+	}, "\n")
+	if s != expect {
+		t.Errorf("mismatch\n given =\n%s\n expect=\n%s", s, expect)
+	}
+
+	if _, err := bit.Diagram(S{}, 0); err == nil {
+		t.Errorf("Diagram should fail for width 0")
+	}
+}
+
+func TestDiagramSVG(t *testing.T) {
+	type S struct {
+		A uint8 `bit:"bits=4"`
+		B uint8 `bit:"bits=4"`
+		C uint16
+	}
+
+	s, err := bit.DiagramSVG(S{}, 16)
+	if err != nil {
+		t.Fatalf("DiagramSVG error:%s", err)
+	}
+	if !strings.HasPrefix(s, "<svg ") || !strings.HasSuffix(s, "</svg>\n") {
+		t.Errorf("not svg:%s", s)
+	}
+	/* C is split into 2 rows */
+	if n := strings.Count(s, "<rect "); n != 4 {
+		t.Errorf("the number of rect given=%d expect=4\n%s", n, s)
+	}
+	for _, label := range []string{">A</text>", ">B</text>", ">C</text>"} {
+		if !strings.Contains(s, label) {
+			t.Errorf("%s is not found\n%s", label, s)
+		}
+	}
+}
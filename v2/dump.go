@@ -0,0 +1,245 @@
+/*
+   Copyright 2020 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package bit
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/goccy/go-reflect"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+const (
+	dumpMaxHex  = 8 /* bytes */
+	dumpMaxBits = 4 /* bytes */
+)
+
+// Dump decodes buf into v and writes each field to w like a detail pane of protocol analyzer.
+// v must be a pointer. Each line has the bit range "Byte.Bit-Byte.Bit", the hex of the bytes,
+// the bits of the field in the bytes (MSB is left) and the decoded value. Nested field is indented.
+//   0.0-1.7    12 34                SrcPort: 4660 (0x1234)
+//   12.0-12.3  50     0101 ....     DataOff: 5 (0x5)
+//   13.1       12     .... ..1.     ECE: 1
+// If the decoding fails, Dump writes the fields which are decoded before the error,
+// marks the field which can not be decoded with "!!" and returns the error.
+//   6.0-6.7    ff                   TTL: -1 (0xff)
+//   7.0-10.7   c0 a8                Src: !! isInRange:out of range
+func Dump(w io.Writer, buf []byte, order binary.ByteOrder, v interface{}) error {
+	_, decErr := Unmarshal(buf, Offset{}, order, v)
+	var derr *DecodeError
+	if decErr != nil && !errors.As(decErr, &derr) {
+		return decErr
+	}
+	var l layout
+	if _, err := l.value(reflect.Indirect(reflect.ValueOf(v)), "", 0, nil, orderNames{}); err != nil {
+		if decErr != nil {
+			return decErr
+		}
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	marked := false
+	for i, f := range l.fields {
+		if derr != nil && !isChildPath(f.Path, derr.Path) {
+			/* stop at the field which can not be decoded */
+			if f.Path == derr.Path {
+				names := splitPath(f.Path)
+				label := strings.Repeat("  ", len(names)-1) + names[len(names)-1]
+				fmt.Fprintf(tw, "%s\t%s\t\t%s: !! %s\n", dumpRange(f), dumpHex(buf, f), label, derr.Err)
+				marked = true
+				break
+			} else if f.Offset.Bits()+uint64(f.BitSize) > derr.Offset.Bits() {
+				break
+			}
+		}
+		names := splitPath(f.Path)
+		label := strings.Repeat("  ", len(names)-1) + names[len(names)-1]
+		var bits string
+		if i+1 < len(l.fields) && isChildPath(f.Path, l.fields[i+1].Path) {
+			/* struct or array. the children follow. */
+			if k := l.values[i].Kind(); k == reflect.Array || k == reflect.Slice {
+				label += fmt.Sprintf(" (%d elements)", l.values[i].Len())
+			}
+		} else {
+			label += ": " + dumpValue(l.values[i], f, buf, order)
+			msbFirst := bitOrderOf(dumpOrder(f, order)) == MSB0 && !isPerByte(l.values[i], l.cnfs[i])
+			bits = dumpBits(buf, f, msbFirst)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", dumpRange(f), dumpHex(buf, f), bits, label)
+	}
+	if derr != nil && !marked {
+		/* the field is not in the layout. e.g. the error of the top level value */
+		fmt.Fprintf(tw, "%s\t\t\t!! %s\n", dumpRange(FieldInfo{Offset: derr.Offset, BitSize: derr.Size}), derr)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	return decErr
+}
+
+// isChildPath returns true if child is a field or an element of path.
+func isChildPath(path, child string) bool {
+	return len(child) > len(path) && strings.HasPrefix(child, path) && (child[len(path)] == '.' || child[len(path)] == '[')
+}
+
+// dumpRange returns the range of f. e.g. "12.0-12.3"
+func dumpRange(f FieldInfo) string {
+	start := fmt.Sprintf("%d.%d", f.Offset.Byte, f.Offset.Bit)
+	if f.BitSize <= 1 {
+		return start
+	}
+	end := Offset{Bit: f.Offset.Bits() + uint64(f.BitSize) - 1}
+	end.Normalize()
+	return fmt.Sprintf("%s-%d.%d", start, end.Byte, end.Bit)
+}
+
+// dumpBytes returns the bytes which f occupies.
+func dumpBytes(buf []byte, f FieldInfo) []byte {
+	if f.BitSize <= 0 || f.Offset.Byte >= uint64(len(buf)) {
+		return nil
+	}
+	end := uint64(sizeOfBits(int(f.Offset.Bits()) + f.BitSize))
+	if end > uint64(len(buf)) {
+		end = uint64(len(buf))
+	}
+	return buf[f.Offset.Byte:end]
+}
+
+// dumpHex returns the hex of the bytes which f occupies. e.g. "12 34"
+func dumpHex(buf []byte, f FieldInfo) string {
+	b := dumpBytes(buf, f)
+	var sb strings.Builder
+	for i := 0; i < len(b) && i < dumpMaxHex; i++ {
+		if i > 0 {
+			sb.WriteString(" ")
+		}
+		fmt.Fprintf(&sb, "%02x", b[i])
+	}
+	if len(b) > dumpMaxHex {
+		sb.WriteString(" ...")
+	}
+	return sb.String()
+}
+
+// isPerByte returns true if v is read per byte like plain integer field.
+// The bits of such field are numbered from LSB regardless of the byte order.
+func isPerByte(v reflect.Value, cnf *tagConfig) bool {
+	if cnf != nil && (cnf.skip || cnf.bits > 0 || cnf.str != nil || cnf.fixed != nil || cnf.scale != nil) {
+		return false
+	}
+	v = reflect.Indirect(v)
+	switch v.Kind() {
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Float32, reflect.Float64:
+		return true
+	case reflect.Array, reflect.Slice:
+		return v.Type().Elem().Kind() == reflect.Uint8
+	}
+	return false
+}
+
+// dumpBits returns the bits of f in the bytes. The bits out of f are ".". e.g. ".... 1..."
+// msbFirst means that the bit 0 of the byte is MSB.
+// It returns "" if f is byte aligned or it is too long.
+func dumpBits(buf []byte, f FieldInfo, msbFirst bool) string {
+	b := dumpBytes(buf, f)
+	if (f.Offset.Bit == 0 && f.BitSize%8 == 0) || len(b) == 0 || len(b) > dumpMaxBits {
+		return ""
+	}
+
+	start, end := f.Offset.Bits(), f.Offset.Bits()+uint64(f.BitSize)
+	var sb strings.Builder
+	for i, c := range b {
+		if i > 0 {
+			sb.WriteString(" ")
+		}
+		for d := 0; d < 8; d++ {
+			if d == 4 {
+				sb.WriteString(" ")
+			}
+			/* d is the position from MSB. bitAddr is the position in the bit order. */
+			bitAddr := d
+			if !msbFirst {
+				bitAddr = 7 - d
+			}
+			pos := (f.Offset.Byte+uint64(i))*8 + uint64(bitAddr)
+			if pos < start || pos >= end {
+				sb.WriteString(".")
+			} else if c&(0x80>>uint(d)) != 0 {
+				sb.WriteString("1")
+			} else {
+				sb.WriteString("0")
+			}
+		}
+	}
+	return sb.String()
+}
+
+// dumpOrder returns the byte order and the bit order of f. order is the byte order passed to Dump.
+func dumpOrder(f FieldInfo, order binary.ByteOrder) binary.ByteOrder {
+	switch f.ByteOrder {
+	case "BE":
+		order = binary.BigEndian
+	case "LE":
+		order = binary.LittleEndian
+	}
+	switch f.BitOrder {
+	case "msb":
+		order = withBitOrder(order, MSB0)
+	case "lsb":
+		order = withBitOrder(order, LSB0)
+	}
+	return order
+}
+
+// dumpValue returns the decoded value of v.
+// Skipped or not exported field shows the raw value in buf.
+func dumpValue(v reflect.Value, f FieldInfo, buf []byte, order binary.ByteOrder) string {
+	skip := false
+	for _, t := range f.Tags {
+		skip = skip || t == "skip"
+	}
+	if skip || !v.CanInterface() {
+		if f.BitSize == 0 || f.BitSize > 64 {
+			return ""
+		}
+		raw, err := getUint(buf, f.Offset, f.BitSize, dumpOrder(f, order))
+		if err != nil {
+			return ""
+		}
+		return fmt.Sprintf("%d (0x%x)", raw, raw)
+	}
+
+	v = reflect.Indirect(v)
+	if v.Kind() == reflect.Interface && !v.IsNil() {
+		v = reflect.Indirect(v.Elem())
+	}
+	switch v.Kind() {
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uint:
+		return fmt.Sprintf("%d (0x%x)", v.Uint(), v.Uint())
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Int:
+		return fmt.Sprintf("%d (0x%x)", v.Int(), uint64(v.Int())&(1<<uint(v.Type().Bits())-1))
+	case reflect.String:
+		return fmt.Sprintf("%q", v.String())
+	}
+	return fmt.Sprintf("%v", v.Interface())
+}
@@ -0,0 +1,125 @@
+/*
+   Copyright 2020 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package bit_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/nokute78/go-bit/v2"
+	"os"
+	"strings"
+	"testing"
+)
+
+type dumpIPv4 struct {
+	Version uint8 `bit:"bits=4"`
+	IHL     uint8 `bit:"bits=4"`
+	TOS     uint8
+	Length  uint16
+	Flags   struct {
+		_  bit.Bit
+		DF bit.Bit
+		MF bit.Bit
+	} `bit:"msb"`
+	FragOff uint16 `bit:"bits=13"`
+	TTL     int8
+	Src     [4]byte `bit:"LE"`
+}
+
+func ExampleDump() {
+	var h dumpIPv4
+	buf := []byte{0x45, 0x00, 0x00, 0x14, 0x40, 0x00, 0xff, 192, 168, 0, 1}
+	if err := bit.Dump(os.Stdout, buf, binary.BigEndian, &h); err != nil {
+		fmt.Printf("error:%s\n", err)
+	}
+	// Output:
+	// 0.0-0.3   45           0100 ....            Version: 4 (0x4)
+	// 0.4-0.7   45           .... 0101            IHL: 5 (0x5)
+	// 1.0-1.7   00                                TOS: 0 (0x0)
+	// 2.0-3.7   00 14                             Length: 20 (0x14)
+	// 4.0-4.2   40                                Flags
+	// 4.0       40           0... ....              _: 0 (0x0)
+	// 4.1       40           .1.. ....              DF: 1
+	// 4.2       40           ..0. ....              MF: 0
+	// 4.3-5.7   40 00        ...0 0000 0000 0000  FragOff: 0 (0x0)
+	// 6.0-6.7   ff                                TTL: -1 (0xff)
+	// 7.0-10.7  c0 a8 00 01                       Src: [192 168 0 1]
+}
+
+func TestDump(t *testing.T) {
+	type Option struct {
+		Kind uint8 `bit:"bits=3"`
+		Len  uint8 `bit:"bits=5"`
+	}
+	type Msg struct {
+		Flag    bit.Bit
+		N       uint8    `bit:"bits=3"`
+		_       uint8    `bit:"bits=4"`
+		Opts    []Option `bit:"len=N"`
+		Name    string   `bit:"str=3"`
+		Payload [10]byte
+	}
+
+	/* LSB first */
+	buf := []byte{0x05, 0x29, 0xfa, 'a', 'b', 0, 0, 1, 2, 3, 4, 5, 6, 7, 8, 9}
+	var m Msg
+	var b bytes.Buffer
+	if err := bit.Dump(&b, buf, binary.LittleEndian, &m); err != nil {
+		t.Fatalf("Dump error:%s", err)
+	}
+	expect := strings.Join([]string{
+		"0.0       05                           .... ...1  Flag: 1",
+		"0.1-0.3   05                           .... 010.  N: 2 (0x2)",
+		"0.4-0.7   05                           0000 ....  _: 0 (0x0)",
+		"1.0-2.7   29 fa                                   Opts (2 elements)",
+		"1.0-1.7   29                                        [0]",
+		"1.0-1.2   29                           .... .001      Kind: 1 (0x1)",
+		"1.3-1.7   29                           0010 1...      Len: 5 (0x5)",
+		"2.0-2.7   fa                                        [1]",
+		"2.0-2.2   fa                           .... .010      Kind: 2 (0x2)",
+		"2.3-2.7   fa                           1111 1...      Len: 31 (0x1f)",
+		"3.0-5.7   61 62 00                                Name: \"ab\"",
+		"6.0-15.7  00 01 02 03 04 05 06 07 ...             Payload: [0 1 2 3 4 5 6 7 8 9]",
+		"",
+	}, "\n")
+	if b.String() != expect {
+		t.Errorf("mismatch\n given =\n%s\n expect=\n%s", b.String(), expect)
+	}
+}
+
+func TestDumpError(t *testing.T) {
+	var h dumpIPv4
+	var b bytes.Buffer
+	err := bit.Dump(&b, []byte{0x45, 0x00, 0x00, 0x14, 0x40, 0x00, 0xff, 192, 168}, binary.BigEndian, &h)
+	if !errors.Is(err, bit.ErrShortBuffer) {
+		t.Errorf("errors.Is(err, ErrShortBuffer) is false. err=%v", err)
+	}
+
+	/* the fields before Src are written and Src is marked */
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	if len(lines) != 11 {
+		t.Fatalf("lines given=%d expect=11\n%s", len(lines), b.String())
+	}
+	if !strings.Contains(lines[9], "TTL: -1 (0xff)") {
+		t.Errorf("TTL is not written. given=%q", lines[9])
+	}
+	if !strings.HasPrefix(lines[10], "7.0-10.7") || !strings.Contains(lines[10], "Src: !! ") {
+		t.Errorf("Src is not marked. given=%q", lines[10])
+	}
+}
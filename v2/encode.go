@@ -21,8 +21,302 @@ import (
 	"fmt"
 	"github.com/goccy/go-reflect"
 	"io"
+	"math"
 )
 
+// putUint writes bitSize bits of val to b at o.
+// The bits are written in the same manner as getUint.
+// It is same as SetBitsBitEndian, but it processes bits per byte.
+func putUint(b []byte, o Offset, val uint64, bitSize int, order binary.ByteOrder) error {
+	if bitSize < 64 && val>>uint(bitSize) != 0 {
+		return fmt.Errorf("%d overflows %d bits", val, bitSize)
+	}
+	if _, err := isInRange(b, o, uint64(bitSize)); err != nil {
+		return err
+	}
+	msb := bitOrderOf(order) == MSB0
+	big := byteOrderOf(order) == binary.BigEndian
+	pos := o.Bits()
+
+	for n := bitSize; n > 0; {
+		bitAddr := int(pos % 8)
+		size := 8 - bitAddr
+		if size > n {
+			size = n
+		}
+		var chunk byte
+		if big {
+			chunk = byte(val >> uint(n-size))
+		} else {
+			chunk = byte(val >> uint(bitSize-n))
+		}
+		shift := uint(bitAddr)
+		if msb {
+			shift = uint(8 - bitAddr - size)
+		}
+		mask := byte(1<<uint(size)-1) << shift
+		b[pos/8] = b[pos/8]&^mask | chunk<<shift&mask
+		pos += uint64(size)
+		n -= size
+	}
+	return nil
+}
+
+// writeUint writes bitSize bits of val to b at o and advances o.
+func writeUint(b []byte, o *Offset, val uint64, bitSize int, order binary.ByteOrder) error {
+	if err := putUint(b, *o, val, bitSize, order); err != nil {
+		return err
+	}
+	var err error
+	*o, err = o.AddOffset(Offset{Bit: uint64(bitSize)})
+	return err
+}
+
+// writeBits writes v to b as bitSize bits integer.
+func writeBits(v reflect.Value, order binary.ByteOrder, b []byte, o *Offset, bitSize int) error {
+	var err error
+	if !v.CanInterface() {
+		// skip unexported field
+		*o, err = o.AddOffset(Offset{Bit: uint64(bitSize)})
+		if err != nil {
+			return err
+		}
+		return errCannotInterface
+	}
+	if err := checkBitsField(v, bitSize); err != nil {
+		return err
+	}
+
+	var val uint64
+	switch v.Kind() {
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Int:
+		i := v.Int()
+		if bitSize < 64 && (i < -(1<<uint(bitSize-1)) || i >= 1<<uint(bitSize-1)) {
+			return fmt.Errorf("%d overflows %d bits", i, bitSize)
+		}
+		val = uint64(i)
+		if bitSize < 64 {
+			val &= 1<<uint(bitSize) - 1
+		}
+	default:
+		val = v.Uint()
+	}
+
+	if err := putUint(b, *o, val, bitSize, order); err != nil {
+		return err
+	}
+
+	*o, err = o.AddOffset(Offset{Bit: uint64(bitSize)})
+	return err
+}
+
+// writeBytes writes byte slice bs to b at o.
+func writeBytes(b []byte, o Offset, bs []byte) error {
+	o.Normalize()
+	if o.Bit == 0 {
+		if _, err := isInRange(b, o, uint64(len(bs)*8)); err != nil {
+			return err
+		}
+		copy(b[o.Byte:], bs)
+		return nil
+	}
+	bits, err := GetBits(bs, Offset{0, 0}, uint64(len(bs)*8), binary.LittleEndian)
+	if err != nil {
+		return err
+	}
+	return SetBits(b, o, bits, binary.LittleEndian)
+}
+
+// lengthFields returns the lengths of slices which are referred by len=Name or size=Name tag.
+// The key is the name of the field which holds the length.
+func lengthFields(v reflect.Value, p *typePlan) (map[string]int, error) {
+	var ret map[string]int
+	for _, fp := range p.fields {
+		i := fp.index
+		cnf := fp.cnf
+		if cnf == nil || cnf.ignore || (cnf.lenField == "" && cnf.sizeField == "") {
+			continue
+		}
+		if ret == nil {
+			ret = map[string]int{}
+		}
+		if cnf.lenField != "" {
+			ret[cnf.lenField] = v.Field(i).Len()
+			continue
+		}
+		var bitSize int
+		sizeOfValueInBits(&bitSize, v.Field(i))
+		if bitSize%8 != 0 {
+			return nil, fmt.Errorf("size=%s: %d bits is not multiple of byte", cnf.sizeField, bitSize)
+		}
+		ret[cnf.sizeField] = bitSize / 8
+	}
+	return ret, nil
+}
+
+// withLength returns a copy of f which value is n.
+func withLength(f reflect.Value, n int) (reflect.Value, error) {
+	ret := reflect.New(f.Type()).Elem()
+	switch f.Kind() {
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uint:
+		ret.SetUint(uint64(n))
+		if ret.Uint() != uint64(n) {
+			return ret, fmt.Errorf("length %d overflows %s", n, f.Type())
+		}
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Int:
+		ret.SetInt(int64(n))
+		if ret.Int() != int64(n) {
+			return ret, fmt.Errorf("length %d overflows %s", n, f.Type())
+		}
+	default:
+		return ret, fmt.Errorf("length field is not integer. %s", f.Kind())
+	}
+	return ret, nil
+}
+
+// writeStruct writes each field of v to b.
+func writeStruct(v reflect.Value, order binary.ByteOrder, b []byte, o *Offset) error {
+	p := planOf(v.Type())
+	if p.err != nil {
+		return encodeError(p.err.err, p.err.field, *o, 0)
+	}
+	lengths, err := lengthFields(v, p)
+	if err != nil {
+		return err
+	}
+
+	/* the end of the struct. overlapped field by "at=" may move o backward. */
+	base, end := *o, *o
+	defer func() {
+		if end.Bits() > o.Bits() {
+			*o = end
+		}
+	}()
+
+	/* the range of each field to compute checksum */
+	var spans []fieldSpan
+	if p.checksum {
+		spans = make([]fieldSpan, len(p.fields))
+	}
+
+	for _, fp := range p.fields {
+		if o.Bits() > end.Bits() {
+			end = *o
+		}
+		if spans != nil {
+			if fp.index > 0 {
+				spans[fp.index-1].end = *o
+			}
+			spans[fp.index].start = *o
+		}
+		cnf := fp.cnf
+		fv := v.Field(fp.index)
+		if n, ok := lengths[fp.name]; ok && fv.CanInterface() {
+			/* write the length of the slice instead of the field value */
+			fv, err = withLength(fv, n)
+			if err != nil {
+				return encodeError(err, fp.name, *o, fp.staticSize(fv.Type(), nil))
+			}
+		}
+		if cnf != nil {
+			/* struct tag is defined */
+			if cnf.ignore {
+				continue
+			}
+			if cnf.cond != nil {
+				ok, err := cnf.cond.eval(v)
+				if err != nil {
+					return encodeError(err, fp.name, *o, 0)
+				} else if !ok {
+					/* the field doesn't exist */
+					continue
+				}
+			}
+			if err := cnf.moveTo(base, o); err != nil {
+				return encodeError(err, fp.name, *o, 0)
+			}
+			if spans != nil {
+				spans[fp.index].start = *o
+			}
+			if cnf.switchField != "" && fv.CanInterface() {
+				/* the variant must be decoded by the same switch value */
+				if err := checkVariant(v, fv, cnf.switchField); err != nil {
+					return encodeError(err, fp.name, *o, 0)
+				}
+			}
+		}
+		start := *o
+		if err := writeField(fv, order, b, fp, o); err != nil && err != errCannotInterface {
+			return encodeError(err, fp.name, start, fp.staticSize(fv.Type(), nil))
+		}
+	}
+	if spans != nil {
+		spans[len(spans)-1].end = *o
+		if err := fillChecksums(b, order, p, spans); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeField writes the field fp whose value is fv to b.
+func writeField(fv reflect.Value, order binary.ByteOrder, b []byte, fp fieldPlan, o *Offset) error {
+	cnf := fp.cnf
+	if cnf == nil {
+		return write(fv, order, b, o)
+	}
+
+	var err error
+	fieldOrder := cnf.order(order)
+	if cnf.reverse && fv.CanInterface() {
+		/* write the reversed copy */
+		fv, err = reversed(fv, cnf.bits)
+		if err != nil {
+			return err
+		}
+	}
+	if cnf.constraint != nil {
+		/* the constant is written regardless of the value */
+		return cnf.constraint.put(b, fieldOrder, o, fieldSize(fv, cnf), fp.name)
+	}
+	if cnf.skip {
+		bitSize := fieldSize(fv, cnf)
+		/* only updates offset. not fill. */
+		*o, err = o.AddOffset(Offset{Bit: uint64(bitSize)})
+		return err
+	}
+	if cnf.str != nil {
+		return writeString(fv, fieldOrder, b, o, cnf.str)
+	}
+	if cnf.scale != nil {
+		return writeScaled(fv, fieldOrder, b, o, cnf)
+	}
+	if cnf.fixed != nil {
+		return writeFixed(fv, fieldOrder, b, o, cnf.fixed)
+	}
+	if cnf.bits > 0 {
+		return writeBits(fv, fieldOrder, b, o, cnf.bits)
+	}
+	if cnf.bitOrder != nil && isBitArray(fv) {
+		/* v[i] is the i-th bit in the bit order */
+		return writeBitArray(fv, b, o, *cnf.bitOrder)
+	}
+	if (cnf.lenField != "" || cnf.sizeField != "") && fv.CanInterface() &&
+		fv.Kind() == reflect.Slice && fv.Type().Elem().Kind() == reflect.Uint8 {
+		/* the payload is written in wire order. it is not reversed even if order is BigEndian. */
+		bs := make([]byte, fv.Len())
+		for i := range bs {
+			bs[i] = byte(fv.Index(i).Uint())
+		}
+		if err := writeBytes(b, *o, bs); err != nil {
+			return err
+		}
+		*o, err = o.AddOffset(Offset{Byte: uint64(len(bs))})
+		return err
+	}
+	return write(fv, fieldOrder, b, o)
+}
+
 // write writes v to b.
 func write(v reflect.Value, order binary.ByteOrder, b []byte, o *Offset) error {
 	var off Offset
@@ -30,68 +324,117 @@ func write(v reflect.Value, order binary.ByteOrder, b []byte, o *Offset) error {
 
 	if !v.CanInterface() {
 		// skip unexported field
-		var size int
-		sizeOfValueInBits(&size, v, false)
+		size := planOf(v.Type()).size
+		if size < 0 {
+			size = 0
+		}
 		*o, err = o.AddOffset(Offset{Bit: uint64(size)})
 		if err != nil {
 			return err
 		}
 		return errCannotInterface
 	}
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			if planOf(v.Type().Elem()).size < 0 {
+				/* the size of the zero value is unknown. write nothing. */
+				return nil
+			}
+			/* nil pointer is written as the zero value */
+			return write(reflect.New(v.Type().Elem()).Elem(), order, b, o)
+		}
+		return write(v.Elem(), order, b, o)
+	}
+	if m, ok := asMarshaler(v); ok {
+		return marshal(m, b, order, o)
+	}
 
 	d := v.Interface()
 
 	switch d.(type) {
 	case uint8:
-		val := d.(uint8)
-		bits, err := GetBits([]byte{byte(val)}, Offset{0, 0}, 8, order)
-		if err != nil {
-			return err
-		}
-		if err := SetBits(b, *o, bits, binary.LittleEndian); err != nil {
+		if err := writeBytes(b, *o, []byte{d.(uint8)}); err != nil {
 			return err
 		}
 		off = Offset{1, 0}
 	case uint16:
-		val := d.(uint16)
 		bs := make([]byte, 2)
-		order.PutUint16(bs, val)
-		bits, err := GetBits(bs, Offset{0, 0}, 16, binary.LittleEndian)
-		if err != nil {
-			return err
-		}
-		if err := SetBits(b, *o, bits, binary.LittleEndian); err != nil {
+		order.PutUint16(bs, d.(uint16))
+		if err := writeBytes(b, *o, bs); err != nil {
 			return err
 		}
 		off = Offset{2, 0}
-
 	case uint32:
-		val := d.(uint32)
 		bs := make([]byte, 4)
-		order.PutUint32(bs, val)
-		bits, err := GetBits(bs, Offset{0, 0}, 32, binary.LittleEndian)
-		if err != nil {
+		order.PutUint32(bs, d.(uint32))
+		if err := writeBytes(b, *o, bs); err != nil {
+			return err
+		}
+		off = Offset{4, 0}
+	case uint64:
+		bs := make([]byte, 8)
+		order.PutUint64(bs, d.(uint64))
+		if err := writeBytes(b, *o, bs); err != nil {
 			return err
 		}
-		if err := SetBits(b, *o, bits, binary.LittleEndian); err != nil {
+		off = Offset{8, 0}
+	case int8:
+		if err := writeBytes(b, *o, []byte{byte(d.(int8))}); err != nil {
+			return err
+		}
+		off = Offset{1, 0}
+	case int16:
+		bs := make([]byte, 2)
+		order.PutUint16(bs, uint16(d.(int16)))
+		if err := writeBytes(b, *o, bs); err != nil {
+			return err
+		}
+		off = Offset{2, 0}
+	case int32:
+		bs := make([]byte, 4)
+		order.PutUint32(bs, uint32(d.(int32)))
+		if err := writeBytes(b, *o, bs); err != nil {
 			return err
 		}
 		off = Offset{4, 0}
-	case uint64:
-		val := d.(uint64)
+	case int64:
 		bs := make([]byte, 8)
-		order.PutUint64(bs, val)
-		bits, err := GetBits(bs, Offset{0, 0}, 64, binary.LittleEndian)
-		if err != nil {
+		order.PutUint64(bs, uint64(d.(int64)))
+		if err := writeBytes(b, *o, bs); err != nil {
 			return err
 		}
-		if err := SetBits(b, *o, bits, binary.LittleEndian); err != nil {
+		off = Offset{8, 0}
+	case float32:
+		bs := make([]byte, 4)
+		order.PutUint32(bs, math.Float32bits(d.(float32)))
+		if err := writeBytes(b, *o, bs); err != nil {
+			return err
+		}
+		off = Offset{4, 0}
+	case float64:
+		bs := make([]byte, 8)
+		order.PutUint64(bs, math.Float64bits(d.(float64)))
+		if err := writeBytes(b, *o, bs); err != nil {
 			return err
 		}
 		off = Offset{8, 0}
+	case Float16:
+		bs := make([]byte, 2)
+		order.PutUint16(bs, uint16(d.(Float16)))
+		if err := writeBytes(b, *o, bs); err != nil {
+			return err
+		}
+		off = Offset{2, 0}
+	case BFloat16:
+		bs := make([]byte, 2)
+		order.PutUint16(bs, uint16(d.(BFloat16)))
+		if err := writeBytes(b, *o, bs); err != nil {
+			return err
+		}
+		off = Offset{2, 0}
 	case Bit:
 		val := d.(Bit)
-		if err := SetBitsBitEndian(b, *o, []Bit{val}, order); err != nil {
+		if err := setBits(b, *o, []Bit{val}, order); err != nil {
 			return err
 		}
 		off = Offset{0, 1}
@@ -108,7 +451,7 @@ func write(v reflect.Value, order binary.ByteOrder, b []byte, o *Offset) error {
 						bits[i] = Bit(v.Index(i).Bool())
 					}
 
-					if err := SetBitsBitEndian(b, *o, bits, order); err != nil {
+					if err := setBits(b, *o, bits, order); err != nil {
 						return err
 					}
 					off = Offset{0, uint64(bitSize)}
@@ -125,7 +468,7 @@ func write(v reflect.Value, order binary.ByteOrder, b []byte, o *Offset) error {
 							bs[i] = byte(v.Index(i).Uint())
 						}
 					}
-					bits, err := GetBits(bs, Offset{0, 0}, uint64(v.Len()*8), order)
+					bits, err := GetBits(bs, Offset{0, 0}, uint64(v.Len()*8), byteOrderOf(order))
 					if err != nil {
 						return err
 					}
@@ -135,46 +478,24 @@ func write(v reflect.Value, order binary.ByteOrder, b []byte, o *Offset) error {
 					off = Offset{uint64(v.Len()), 0}
 				} else {
 					for i := 0; i < v.Len(); i++ {
+						start := *o
 						err := write(v.Index(i), order, b, o)
 						if err != nil && err != errCannotInterface {
-							return err
+							return encodeError(err, fmt.Sprintf("[%d]", i), start, planOf(v.Type().Elem()).size)
 						}
 					}
 				}
 			}
 		case reflect.Struct:
-			for i := 0; i < v.Type().NumField(); i++ {
-				f := v.Type().Field(i)
-				cnf := parseStructTag(f.Tag)
-				if cnf != nil {
-					/* struct tag is defined */
-					if cnf.ignore {
-						continue
-					} else if cnf.skip {
-						var bitSize int
-						/* only updates offset. not fill. */
-						sizeOfValueInBits(&bitSize, v.Field(i), true)
-						*o, err = o.AddOffset(Offset{Bit: uint64(bitSize)})
-						if err != nil {
-							return err
-						}
-						continue
-					} else if cnf.endian != nil {
-						err := write(v.Field(i), cnf.endian, b, o)
-						if err != nil && err != errCannotInterface {
-							return err
-						}
-						continue
-					}
-				}
-				err := write(v.Field(i), order, b, o)
-				if err != nil && err != errCannotInterface {
-					return err
-				}
+			return writeStruct(v, order, b, o)
+		case reflect.Interface:
+			e, err := variantValue(v)
+			if err != nil {
+				return err
 			}
-			return nil
+			return write(e, order, b, o)
 		default:
-			return fmt.Errorf("Not Supported %s", v.Kind())
+			return fmt.Errorf("%w %s", ErrUnsupportedType, v.Kind())
 		}
 	}
 
@@ -184,6 +505,8 @@ func write(v reflect.Value, order binary.ByteOrder, b []byte, o *Offset) error {
 }
 
 // Write writes structured binary data from input into w.
+// Nil pointer field is written as the zero value.
+// It returns *EncodeError which has the path of the field if the field can not be encoded.
 func Write(w io.Writer, order binary.ByteOrder, input interface{}) error {
 	v := reflect.ValueOf(input)
 	var vv reflect.Value
@@ -199,11 +522,40 @@ func Write(w io.Writer, order binary.ByteOrder, input interface{}) error {
 
 	var c int = 0
 	var off Offset
-	sizeOfValueInBits(&c, vv, true)
+	sizeOfValueInBits(&c, vv)
 	byteSize := sizeOfBits(c)
 	barr := make([]byte, byteSize)
 
-	err := write(vv, order, barr, &off)
-	_, err = w.Write(barr)
+	if err := write(vv, order, barr, &off); err != nil && err != errCannotInterface {
+		return encodeError(err, "", Offset{}, c)
+	}
+	_, err := w.Write(barr)
 	return err
 }
+
+// Marshal returns the encoded bytes of input and its size in bits.
+// The last byte is padded with 0 if the size is not multiple of 8.
+func Marshal(input interface{}, order binary.ByteOrder) ([]byte, uint64, error) {
+	v := reflect.Indirect(reflect.ValueOf(input))
+
+	var c int = 0
+	sizeOfValueInBits(&c, v)
+	ret := make([]byte, sizeOfBits(c))
+	if err := write(v, order, ret, &Offset{}); err != nil && err != errCannotInterface {
+		return nil, 0, encodeError(err, "", Offset{}, c)
+	}
+	return ret, uint64(c), nil
+}
+
+// MarshalInto encodes input and writes it to buf from Offset off.
+// It returns the offset next to the encoded value.
+// The bits out of the encoded value are not changed.
+func MarshalInto(buf []byte, off Offset, order binary.ByteOrder, input interface{}) (Offset, error) {
+	v := reflect.Indirect(reflect.ValueOf(input))
+	off.Normalize()
+	start := off
+	if err := write(v, order, buf, &off); err != nil && err != errCannotInterface {
+		return off, encodeError(err, "", start, planOf(v.Type()).size)
+	}
+	return off, nil
+}
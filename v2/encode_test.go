@@ -252,3 +252,240 @@ func TestWriteBigEndian(t *testing.T) {
 		t.Errorf("s=%+v", s)
 	}
 }
+
+func TestWriteBitsTag(t *testing.T) {
+	type S struct {
+		A uint8  `bit:"bits=4"`
+		B uint16 `bit:"bits=12"`
+		C uint8
+	}
+
+	type testcase struct {
+		name   string
+		order  binary.ByteOrder
+		input  S
+		expect []byte
+	}
+
+	cases := []testcase{
+		{"LittleEndian", binary.LittleEndian, S{A: 0xa, B: 0xc35, C: 0x01}, []byte{0x5a, 0xc3, 0x01}},
+		{"BigEndian", binary.BigEndian, S{A: 0x5, B: 0xac3, C: 0x01}, []byte{0x5a, 0xc3, 0x01}},
+	}
+
+	for _, v := range cases {
+		buf := bytes.NewBuffer([]byte{})
+		if err := bit.Write(buf, v.order, &v.input); err != nil {
+			t.Fatalf("%s: bit.Write err=%s", v.name, err)
+		}
+		if bytes.Compare(buf.Bytes(), v.expect) != 0 {
+			t.Errorf("%s: mismatch\n given =%x\n expect=%x", v.name, buf.Bytes(), v.expect)
+		}
+	}
+}
+
+func TestWriteSigned(t *testing.T) {
+	type S struct {
+		I8  int8
+		I16 int16
+		I32 int32
+		I64 int64
+	}
+
+	s := S{-128, 0x7fff, 1, -2}
+	buf := bytes.NewBuffer([]byte{})
+	if err := bit.Write(buf, binary.BigEndian, &s); err != nil {
+		t.Fatalf("bit.Write err=%s", err)
+	}
+	expect := []byte{0x80, 0x7f, 0xff, 0x00, 0x00, 0x00, 0x01, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xfe}
+	if bytes.Compare(buf.Bytes(), expect) != 0 {
+		t.Errorf("mismatch\n given =%x\n expect=%x", buf.Bytes(), expect)
+	}
+}
+
+func TestWriteSignedBitsTag(t *testing.T) {
+	type Telemetry struct {
+		Temp   int16 `bit:"bits=12"`
+		Status uint8 `bit:"bits=4"`
+	}
+
+	s := Telemetry{Temp: -10, Status: 0x5}
+	buf := bytes.NewBuffer([]byte{})
+	if err := bit.Write(buf, binary.BigEndian, &s); err != nil {
+		t.Fatalf("bit.Write err=%s", err)
+	}
+	expect := []byte{0xff, 0x65}
+	if bytes.Compare(buf.Bytes(), expect) != 0 {
+		t.Errorf("mismatch\n given =%x\n expect=%x", buf.Bytes(), expect)
+	}
+}
+
+func TestWriteFloat(t *testing.T) {
+	type S struct {
+		F32 float32
+		F64 float64
+		H   bit.Float16
+		BF  bit.BFloat16
+	}
+
+	type testcase struct {
+		name   string
+		order  binary.ByteOrder
+		expect []byte
+	}
+
+	s := S{F32: 1.5, F64: -0.25, H: bit.NewFloat16(2), BF: bit.NewBFloat16(-1)}
+	cases := []testcase{
+		{"LittleEndian", binary.LittleEndian,
+			[]byte{0x00, 0x00, 0xc0, 0x3f, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xd0, 0xbf, 0x00, 0x40, 0x80, 0xbf}},
+		{"BigEndian", binary.BigEndian,
+			[]byte{0x3f, 0xc0, 0x00, 0x00, 0xbf, 0xd0, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x40, 0x00, 0xbf, 0x80}},
+	}
+
+	for _, v := range cases {
+		buf := bytes.NewBuffer([]byte{})
+		if err := bit.Write(buf, v.order, &s); err != nil {
+			t.Fatalf("%s: bit.Write err=%s", v.name, err)
+		}
+		if bytes.Compare(buf.Bytes(), v.expect) != 0 {
+			t.Errorf("%s: mismatch\n given =%x\n expect=%x", v.name, buf.Bytes(), v.expect)
+		}
+	}
+}
+
+func TestWriteVariableLength(t *testing.T) {
+	type S struct {
+		Count   uint8
+		Data    []uint16 `bit:"len=Count"`
+		Length  uint8
+		Payload []byte `bit:"size=Length"`
+	}
+
+	s := S{Data: []uint16{0x0201, 0x0403}, Payload: []byte{0xaa, 0xbb, 0xcc}}
+	buf := bytes.NewBuffer([]byte{})
+	if err := bit.Write(buf, binary.LittleEndian, s); err != nil {
+		t.Fatalf("bit.Write err=%s", err)
+	}
+	expect := []byte{0x02, 0x01, 0x02, 0x03, 0x04, 0x03, 0xaa, 0xbb, 0xcc}
+	if bytes.Compare(buf.Bytes(), expect) != 0 {
+		t.Errorf("mismatch\n given =%x\n expect=%x", buf.Bytes(), expect)
+	}
+
+	// round trip
+	var r S
+	if err := bit.Read(bytes.NewReader(buf.Bytes()), binary.LittleEndian, &r); err != nil {
+		t.Fatalf("bit.Read err=%s", err)
+	}
+	if r.Count != 2 || r.Length != 3 {
+		t.Errorf("Count=%d Length=%d", r.Count, r.Length)
+	}
+}
+
+func TestWriteCondition(t *testing.T) {
+	type S struct {
+		HasExt bit.Bit
+		Type   uint8  `bit:"bits=7"`
+		Ext    uint16 `bit:"if=HasExt"`
+		Opt    uint8  `bit:"if=Type!=2"`
+	}
+
+	type testcase struct {
+		name   string
+		input  S
+		expect []byte
+	}
+
+	cases := []testcase{
+		{"no ext", S{false, 2, 0xaabb, 0x11}, []byte{0x02}},
+		{"ext", S{true, 3, 0xaabb, 0x11}, []byte{0x83, 0xaa, 0xbb, 0x11}},
+	}
+
+	for _, v := range cases {
+		buf := bytes.NewBuffer([]byte{})
+		if err := bit.Write(buf, binary.BigEndian, v.input); err != nil {
+			t.Fatalf("%s: bit.Write err=%s", v.name, err)
+		}
+		if bytes.Compare(buf.Bytes(), v.expect) != 0 {
+			t.Errorf("%s: mismatch\n given =%x\n expect=%x", v.name, buf.Bytes(), v.expect)
+		}
+	}
+}
+
+func TestWriteError(t *testing.T) {
+	type S struct {
+		A uint8 `bit:"bits=4"`
+		B uint8 `bit:"bits=4"`
+	}
+
+	buf := bytes.NewBuffer([]byte{})
+	if err := bit.Write(buf, binary.BigEndian, S{A: 0x1f}); err == nil {
+		t.Errorf("error is not returned")
+	}
+}
+
+func TestWritePointer(t *testing.T) {
+	type Sub struct {
+		A uint8 `bit:"bits=4"`
+		B uint8 `bit:"bits=4"`
+	}
+	type S struct {
+		Sub *Sub
+		Arr *[2]uint16
+		Nil *uint16
+	}
+
+	ext := [2]uint16{0x01, 0x02}
+	buf := bytes.NewBuffer([]byte{})
+	if err := bit.Write(buf, binary.BigEndian, &S{Sub: &Sub{1, 2}, Arr: &ext}); err != nil {
+		t.Fatalf("bit.Write err=%s", err)
+	}
+	/* nil pointer is written as zero value */
+	expect := []byte{0x12, 0x00, 0x01, 0x00, 0x02, 0x00, 0x00}
+	if bytes.Compare(buf.Bytes(), expect) != 0 {
+		t.Errorf("mismatch\n given =%x\n expect=%x", buf.Bytes(), expect)
+	}
+}
+
+func TestMarshal(t *testing.T) {
+	type S struct {
+		A uint8  `bit:"bits=4"`
+		B uint16 `bit:"bits=12"`
+		C uint8  `bit:"bits=4"`
+	}
+
+	ret, bitLen, err := bit.Marshal(S{A: 0x5, B: 0xac3, C: 0x1}, binary.BigEndian)
+	if err != nil {
+		t.Fatalf("bit.Marshal err=%s", err)
+	}
+	expect := []byte{0x5a, 0xc3, 0x10}
+	if bytes.Compare(ret, expect) != 0 {
+		t.Errorf("mismatch\n given =%x\n expect=%x", ret, expect)
+	}
+	if bitLen != 20 {
+		t.Errorf("bitLen: given=%d expect=20", bitLen)
+	}
+}
+
+func TestMarshalInto(t *testing.T) {
+	type S struct {
+		A uint8 `bit:"bits=4"`
+		B uint8 `bit:"bits=4"`
+	}
+
+	buf := []byte{0xff, 0xff, 0xff}
+	next, err := bit.MarshalInto(buf, bit.Offset{Byte: 1, Bit: 4}, binary.BigEndian, S{A: 0x2, B: 0x3})
+	if err != nil {
+		t.Fatalf("bit.MarshalInto err=%s", err)
+	}
+	expect := []byte{0xff, 0xf2, 0x3f}
+	if bytes.Compare(buf, expect) != 0 {
+		t.Errorf("mismatch\n given =%x\n expect=%x", buf, expect)
+	}
+	if next.Compare(bit.Offset{Byte: 2, Bit: 4}) != 0 {
+		t.Errorf("next: given=%s", next)
+	}
+
+	// out of range
+	if _, err := bit.MarshalInto(buf, bit.Offset{Byte: 2, Bit: 4}, binary.BigEndian, S{}); err == nil {
+		t.Errorf("error is not returned")
+	}
+}
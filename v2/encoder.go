@@ -0,0 +1,139 @@
+/*
+   Copyright 2020 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package bit
+
+import (
+	"encoding/binary"
+	"github.com/goccy/go-reflect"
+	"io"
+)
+
+// Encoder writes encoded values to an output stream.
+// Unlike Write, Encoder doesn't pad each value to a whole byte.
+// So non-byte-aligned values can be packed consecutively.
+// The last partial byte is written by Align or Flush.
+type Encoder struct {
+	w     io.Writer
+	order binary.ByteOrder
+	buf   []byte /* bytes which are not written to w yet */
+	off   Offset /* offset in buf */
+	base  uint64 /* bits which are written to w */
+	pad   Bit
+}
+
+// NewEncoder returns a new encoder that writes to w.
+func NewEncoder(w io.Writer, order binary.ByteOrder) *Encoder {
+	return &Encoder{w: w, order: order}
+}
+
+// SetPadBit sets the bit which is used to pad by Align and Flush.
+// Default is 0.
+func (e *Encoder) SetPadBit(b Bit) {
+	e.pad = b
+}
+
+// grow extends e.buf to hold bitSize bits from e.off.
+func (e *Encoder) grow(bitSize uint64) {
+	need := sizeOfBits(int(e.off.Bits() + bitSize))
+	if need > len(e.buf) {
+		e.buf = append(e.buf, make([]byte, need-len(e.buf))...)
+	}
+}
+
+// advance updates the offset and writes completed bytes to w.
+func (e *Encoder) advance(bitSize uint64) error {
+	var err error
+	e.off, err = e.off.AddOffset(Offset{Bit: bitSize})
+	if err != nil {
+		return err
+	}
+	if e.off.Byte == 0 {
+		return nil
+	}
+	n, err := e.w.Write(e.buf[:e.off.Byte])
+	e.base += uint64(n) * 8
+	if err != nil {
+		/* drop the written bytes to keep base+off consistent */
+		e.buf = append(e.buf[:0], e.buf[n:]...)
+		e.off.Byte -= uint64(n)
+		return err
+	}
+	/* keep the partial byte */
+	e.buf = append(e.buf[:0], e.buf[e.off.Byte:]...)
+	e.off.Byte = 0
+	return nil
+}
+
+// Encode writes the encoded value of v to the stream.
+// v is encoded in the same manner as Write.
+func (e *Encoder) Encode(v interface{}) error {
+	vv := reflect.Indirect(reflect.ValueOf(v))
+
+	var size int
+	sizeOfValueInBits(&size, vv)
+	tmp := make([]byte, sizeOfBits(size))
+	if err := write(vv, e.order, tmp, &Offset{}); err != nil && err != errCannotInterface {
+		return encodeError(err, "", Offset{}, size)
+	}
+	bits, err := GetBitsBitEndian(tmp, Offset{}, uint64(size), e.order)
+	if err != nil {
+		return err
+	}
+
+	e.grow(uint64(size))
+	if err := SetBitsBitEndian(e.buf, e.off, bits, e.order); err != nil {
+		return err
+	}
+	return e.advance(uint64(size))
+}
+
+// WriteBits writes lower bitSize bits of val to the stream.
+// The bits are written in the same manner as `bit:"bits=N"` tag.
+func (e *Encoder) WriteBits(val uint64, bitSize int) error {
+	e.grow(uint64(bitSize))
+	if err := putUint(e.buf, e.off, val, bitSize, e.order); err != nil {
+		return err
+	}
+	return e.advance(uint64(bitSize))
+}
+
+// Align pads the stream with the pad bit to the byte boundary.
+// The padded byte is written to the stream.
+func (e *Encoder) Align() error {
+	if e.off.Bit == 0 {
+		return nil
+	}
+	bitSize := 8 - int(e.off.Bit)
+	var val uint64
+	if e.pad {
+		val = 1<<uint(bitSize) - 1
+	}
+	return e.WriteBits(val, bitSize)
+}
+
+// Flush pads the last partial byte and writes it to the stream.
+func (e *Encoder) Flush() error {
+	return e.Align()
+}
+
+// Offset returns the offset from the beginning of the stream.
+// It includes the bits which are not written yet.
+func (e *Encoder) Offset() Offset {
+	ret := Offset{Bit: e.base + e.off.Bits()}
+	ret.Normalize()
+	return ret
+}
@@ -0,0 +1,156 @@
+/*
+   Copyright 2020 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package bit_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"github.com/nokute78/go-bit/v2"
+	"testing"
+)
+
+func TestEncoder(t *testing.T) {
+	type Record struct {
+		Val uint16 `bit:"bits=12"`
+	}
+
+	buf := bytes.NewBuffer([]byte{})
+	e := bit.NewEncoder(buf, binary.BigEndian)
+	for _, v := range []uint16{0xabc, 0x123} {
+		if err := e.Encode(Record{v}); err != nil {
+			t.Fatalf("Encode error:%s", err)
+		}
+	}
+	if err := e.Flush(); err != nil {
+		t.Fatalf("Flush error:%s", err)
+	}
+
+	expect := []byte{0xab, 0xc1, 0x23}
+	if bytes.Compare(buf.Bytes(), expect) != 0 {
+		t.Errorf("mismatch\n given =%x\n expect=%x", buf.Bytes(), expect)
+	}
+	if off := e.Offset(); off.Bits() != 24 {
+		t.Errorf("Offset given=%s expect=24 bits", off)
+	}
+
+	// round trip
+	d := bit.NewDecoder(bytes.NewReader(buf.Bytes()), binary.BigEndian)
+	for _, v := range []uint16{0xabc, 0x123} {
+		var r Record
+		if err := d.Decode(&r); err != nil {
+			t.Fatalf("Decode error:%s", err)
+		}
+		if r.Val != v {
+			t.Errorf("given=0x%x expect=0x%x", r.Val, v)
+		}
+	}
+}
+
+func TestEncoderAlign(t *testing.T) {
+	type testcase struct {
+		name   string
+		order  binary.ByteOrder
+		pad    bit.Bit
+		expect []byte
+	}
+
+	cases := []testcase{
+		{"BigEndian", binary.BigEndian, false, []byte{0xa0, 0xaa, 0x50}},
+		{"BigEndian pad=1", binary.BigEndian, true, []byte{0xaf, 0xaa, 0x5f}},
+		{"LittleEndian", binary.LittleEndian, false, []byte{0x0a, 0xaa, 0x05}},
+		{"LittleEndian pad=1", binary.LittleEndian, true, []byte{0xfa, 0xaa, 0xf5}},
+	}
+
+	for _, v := range cases {
+		buf := bytes.NewBuffer([]byte{})
+		e := bit.NewEncoder(buf, v.order)
+		e.SetPadBit(v.pad)
+		if err := e.WriteBits(0xa, 4); err != nil {
+			t.Fatalf("%s: WriteBits error:%s", v.name, err)
+		}
+		if err := e.Align(); err != nil {
+			t.Fatalf("%s: Align error:%s", v.name, err)
+		}
+		if err := e.Encode(uint8(0xaa)); err != nil {
+			t.Fatalf("%s: Encode error:%s", v.name, err)
+		}
+		if err := e.WriteBits(0x5, 4); err != nil {
+			t.Fatalf("%s: WriteBits error:%s", v.name, err)
+		}
+		if buf.Len() != 2 {
+			t.Errorf("%s: partial byte is written. len=%d", v.name, buf.Len())
+		}
+		if err := e.Flush(); err != nil {
+			t.Fatalf("%s: Flush error:%s", v.name, err)
+		}
+		if bytes.Compare(buf.Bytes(), v.expect) != 0 {
+			t.Errorf("%s: mismatch\n given =%x\n expect=%x", v.name, buf.Bytes(), v.expect)
+		}
+	}
+}
+
+type errWriter struct{}
+
+var errWrite = errors.New("write error")
+
+func (errWriter) Write(p []byte) (int, error) {
+	return 0, errWrite
+}
+
+func TestEncoderWriteError(t *testing.T) {
+	e := bit.NewEncoder(errWriter{}, binary.BigEndian)
+	if err := e.Encode(uint16(0x1234)); err != errWrite {
+		t.Errorf("err given=%v expect=%v", err, errWrite)
+	}
+}
+
+// shortWriter writes only the first byte on the first call and fails.
+type shortWriter struct {
+	bytes.Buffer
+	failed bool
+}
+
+func (w *shortWriter) Write(p []byte) (int, error) {
+	if !w.failed && len(p) > 1 {
+		w.failed = true
+		w.Buffer.Write(p[:1])
+		return 1, errWrite
+	}
+	return w.Buffer.Write(p)
+}
+
+func TestEncoderShortWrite(t *testing.T) {
+	w := &shortWriter{}
+	e := bit.NewEncoder(w, binary.BigEndian)
+	if err := e.Encode(uint16(0x1234)); err != errWrite {
+		t.Fatalf("err given=%v expect=%v", err, errWrite)
+	}
+	if off := e.Offset(); off.Bits() != 16 {
+		t.Errorf("offset given=%+v expect=16 bits", off)
+	}
+	if err := e.Encode(uint8(0x56)); err != nil {
+		t.Fatalf("error:%s", err)
+	}
+	if off := e.Offset(); off.Bits() != 24 {
+		t.Errorf("offset given=%+v expect=24 bits", off)
+	}
+	expect := []byte{0x12, 0x34, 0x56}
+	if bytes.Compare(w.Bytes(), expect) != 0 {
+		t.Errorf("mismatch\n given =%x\n expect=%x", w.Bytes(), expect)
+	}
+}
@@ -0,0 +1,157 @@
+/*
+   Copyright 2020 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package bit
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+var (
+	// ErrUnsupportedType is returned when the type of the field or the tag for the type is not supported.
+	ErrUnsupportedType = errors.New("Not Supported")
+	// ErrShortBuffer is returned when the buffer is too short to read or write the field.
+	// DecodeError and EncodeError caused by ErrOutOfRange, io.EOF or io.ErrUnexpectedEOF match it.
+	ErrShortBuffer = errors.New("short buffer")
+	// ErrConstraint is returned when the field violates the constraint. e.g. `bit:"const=V"`, `bit:"checksum=Name"`
+	// *ConstraintError matches it.
+	ErrConstraint = errors.New("constraint violation")
+)
+
+// DecodeError describes the field which can not be decoded.
+// Use errors.Is to check the cause. e.g. errors.Is(err, bit.ErrShortBuffer)
+type DecodeError struct {
+	Path   string /* the dotted path of the field. e.g. Hdr.Options[2].Len */
+	Offset Offset /* the offset of the field */
+	Size   int    /* the size of the field in bits. 0 if the size is not fixed */
+	Err    error  /* the cause */
+}
+
+func (e *DecodeError) Error() string {
+	return "bit: cannot decode " + describeField(e.Path, e.Offset, e.Size) + ": " + e.Err.Error()
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+func (e *DecodeError) Is(target error) bool {
+	return target == ErrShortBuffer && isShortBuffer(e.Err)
+}
+
+// EncodeError describes the field which can not be encoded.
+// Use errors.Is to check the cause. e.g. errors.Is(err, bit.ErrShortBuffer)
+type EncodeError struct {
+	Path   string /* the dotted path of the field. e.g. Hdr.Options[2].Len */
+	Offset Offset /* the offset of the field */
+	Size   int    /* the size of the field in bits. 0 if the size is not fixed */
+	Err    error  /* the cause */
+}
+
+func (e *EncodeError) Error() string {
+	return "bit: cannot encode " + describeField(e.Path, e.Offset, e.Size) + ": " + e.Err.Error()
+}
+
+func (e *EncodeError) Unwrap() error {
+	return e.Err
+}
+
+func (e *EncodeError) Is(target error) bool {
+	return target == ErrShortBuffer && isShortBuffer(e.Err)
+}
+
+func (e *ConstraintError) Is(target error) bool {
+	return target == ErrConstraint
+}
+
+func isShortBuffer(err error) bool {
+	return errors.Is(err, ErrOutOfRange) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+func describeField(path string, o Offset, size int) string {
+	var sb strings.Builder
+	if path != "" {
+		sb.WriteString(path)
+		sb.WriteString(" ")
+	}
+	fmt.Fprintf(&sb, "at %s", o)
+	if size > 0 {
+		fmt.Fprintf(&sb, " (%d bits)", size)
+	}
+	return sb.String()
+}
+
+// joinPath prepends name to the path of the nested field.
+//   joinPath("Hdr", "Len")   -> "Hdr.Len"
+//   joinPath("Opts", "[2]")  -> "Opts[2]"
+func joinPath(name, path string) string {
+	switch {
+	case path == "":
+		return name
+	case name == "" || strings.HasPrefix(path, "["):
+		return name + path
+	}
+	return name + "." + path
+}
+
+// splitPath splits the path into the field names and the indexes.
+//   splitPath("Hdr.Opts[2].Len") -> ["Hdr", "Opts", "[2]", "Len"]
+func splitPath(path string) []string {
+	var ret []string
+	for _, name := range strings.Split(strings.Replace(path, "[", ".[", -1), ".") {
+		if name != "" {
+			ret = append(ret, name)
+		}
+	}
+	return ret
+}
+
+// decodeError wraps err as *DecodeError of the field name at o.
+// If err is already *DecodeError of the nested field, name is prepended to its path.
+func decodeError(err error, name string, o Offset, size int) error {
+	if err == nil || err == errCannotInterface {
+		return err
+	}
+	if e, ok := err.(*DecodeError); ok {
+		e.Path = joinPath(name, e.Path)
+		return e
+	}
+	if size < 0 {
+		/* the size of variable-length field is unknown */
+		size = 0
+	}
+	return &DecodeError{Path: name, Offset: o, Size: size, Err: err}
+}
+
+// encodeError wraps err as *EncodeError of the field name at o.
+// If err is already *EncodeError of the nested field, name is prepended to its path.
+func encodeError(err error, name string, o Offset, size int) error {
+	if err == nil || err == errCannotInterface {
+		return err
+	}
+	if e, ok := err.(*EncodeError); ok {
+		e.Path = joinPath(name, e.Path)
+		return e
+	}
+	if size < 0 {
+		/* the size of variable-length field is unknown */
+		size = 0
+	}
+	return &EncodeError{Path: name, Offset: o, Size: size, Err: err}
+}
@@ -0,0 +1,188 @@
+/*
+   Copyright 2020 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package bit_test
+
+import (
+	"encoding/binary"
+	"errors"
+	"github.com/nokute78/go-bit/v2"
+	"testing"
+)
+
+type errOption struct {
+	Kind uint8
+	Len  uint8
+}
+
+type errHeader struct {
+	Ver     uint8 `bit:"bits=4"`
+	_       uint8 `bit:"bits=4"`
+	Options [3]errOption
+}
+
+type errPacket struct {
+	Hdr errHeader
+}
+
+func TestDecodeErrorPath(t *testing.T) {
+	input := []byte{0x10, 1, 2, 3, 4, 5}
+
+	var p errPacket
+	_, err := bit.Unmarshal(input, bit.Offset{}, binary.BigEndian, &p)
+	var derr *bit.DecodeError
+	if !errors.As(err, &derr) {
+		t.Fatalf("DecodeError is not returned. err=%v", err)
+	}
+	if derr.Path != "Hdr.Options[2].Len" {
+		t.Errorf("Path given=%q expect=%q", derr.Path, "Hdr.Options[2].Len")
+	}
+	if derr.Offset != (bit.Offset{Byte: 6}) {
+		t.Errorf("Offset given=%s expect=%s", derr.Offset, bit.Offset{Byte: 6})
+	}
+	if derr.Size != 8 {
+		t.Errorf("Size given=%d expect=8", derr.Size)
+	}
+	if !errors.Is(err, bit.ErrShortBuffer) {
+		t.Errorf("errors.Is(err, ErrShortBuffer) is false. err=%v", err)
+	}
+	if !errors.Is(err, bit.ErrOutOfRange) {
+		t.Errorf("errors.Is(err, ErrOutOfRange) is false. err=%v", err)
+	}
+	if errors.Is(err, bit.ErrConstraint) || errors.Is(err, bit.ErrUnsupportedType) {
+		t.Errorf("unexpected sentinel. err=%v", err)
+	}
+}
+
+func TestEncodeErrorPath(t *testing.T) {
+	p := errPacket{Hdr: errHeader{Ver: 1}}
+	buf := make([]byte, 4)
+
+	_, err := bit.MarshalInto(buf, bit.Offset{}, binary.BigEndian, &p)
+	var eerr *bit.EncodeError
+	if !errors.As(err, &eerr) {
+		t.Fatalf("EncodeError is not returned. err=%v", err)
+	}
+	if eerr.Path != "Hdr.Options[1].Len" || eerr.Offset != (bit.Offset{Byte: 4}) {
+		t.Errorf("given=%+v", eerr)
+	}
+	if !errors.Is(err, bit.ErrShortBuffer) {
+		t.Errorf("errors.Is(err, ErrShortBuffer) is false. err=%v", err)
+	}
+}
+
+func TestErrConstraint(t *testing.T) {
+	type S struct {
+		A    uint8
+		Tail struct {
+			Magic uint16 `bit:"const=0xcafe"`
+		}
+	}
+
+	var s S
+	_, err := bit.Unmarshal([]byte{0x01, 0xca, 0xfd}, bit.Offset{}, binary.BigEndian, &s)
+	if !errors.Is(err, bit.ErrConstraint) {
+		t.Fatalf("errors.Is(err, ErrConstraint) is false. err=%v", err)
+	}
+	var derr *bit.DecodeError
+	if !errors.As(err, &derr) || derr.Path != "Tail.Magic" || derr.Offset != (bit.Offset{Byte: 1}) {
+		t.Errorf("given=%+v", derr)
+	}
+	var cerr *bit.ConstraintError
+	if !errors.As(err, &cerr) || cerr.Actual != 0xcafd {
+		t.Errorf("given=%+v", cerr)
+	}
+	/* the field is described once */
+	expect := "bit: cannot decode Tail.Magic at [Byte:1,Bit:0] (16 bits): expect 0xcafe, but 0xcafd"
+	if err.Error() != expect {
+		t.Errorf("Error()\n given =%s\n expect=%s", err, expect)
+	}
+}
+
+func TestTagErrorPath(t *testing.T) {
+	type S struct {
+		A   uint8
+		Hdr struct {
+			B uint8
+			X uint8 `bit:"bits=9"`
+		}
+	}
+
+	var s S
+	_, err := bit.Unmarshal([]byte{0x01, 0x02, 0x03}, bit.Offset{}, binary.BigEndian, &s)
+	var derr *bit.DecodeError
+	if !errors.As(err, &derr) || derr.Path != "Hdr.X" {
+		t.Errorf("given=%+v", derr)
+	}
+
+	_, _, err = bit.Marshal(&s, binary.BigEndian)
+	var eerr *bit.EncodeError
+	if !errors.As(err, &eerr) || eerr.Path != "Hdr.X" {
+		t.Errorf("given=%+v", eerr)
+	}
+}
+
+func TestErrorSizeDynamic(t *testing.T) {
+	type S struct {
+		N    uint8
+		Data []uint16 `bit:"len=N"`
+		Name string   `bit:"cstr"`
+	}
+
+	var s S
+	_, err := bit.Unmarshal([]byte{0x01, 0x00, 0x00, 0x61}, bit.Offset{}, binary.BigEndian, &s)
+	var derr *bit.DecodeError
+	if !errors.As(err, &derr) || derr.Path != "Name" || derr.Size != 0 {
+		t.Errorf("given=%+v", derr)
+	}
+
+	s = S{Data: []uint16{1}, Name: "a\x00"}
+	_, _, err = bit.Marshal(&s, binary.BigEndian)
+	var eerr *bit.EncodeError
+	if !errors.As(err, &eerr) || eerr.Path != "Name" || eerr.Size != 0 {
+		t.Errorf("given=%+v", eerr)
+	}
+}
+
+func TestErrUnsupportedType(t *testing.T) {
+	type S struct {
+		A uint8
+		B []chan int `bit:"len=A"`
+	}
+
+	var s S
+	_, err := bit.Unmarshal([]byte{0x02, 0x00}, bit.Offset{}, binary.LittleEndian, &s)
+	if !errors.Is(err, bit.ErrUnsupportedType) {
+		t.Fatalf("errors.Is(err, ErrUnsupportedType) is false. err=%v", err)
+	}
+	var derr *bit.DecodeError
+	if !errors.As(err, &derr) || derr.Path != "B[0]" {
+		t.Errorf("given=%+v", derr)
+	}
+
+	s.B = make([]chan int, 1)
+	if _, _, err := bit.Marshal(&s, binary.LittleEndian); !errors.Is(err, bit.ErrUnsupportedType) {
+		t.Errorf("errors.Is(err, ErrUnsupportedType) is false. err=%v", err)
+	}
+}
+
+func TestDecodeErrorMessage(t *testing.T) {
+	err := &bit.DecodeError{Path: "Hdr.Len", Offset: bit.Offset{Byte: 2, Bit: 4}, Size: 12, Err: bit.ErrOutOfRange}
+	expect := "bit: cannot decode Hdr.Len at [Byte:2,Bit:4] (12 bits): out of range"
+	if err.Error() != expect {
+		t.Errorf("given=%q expect=%q", err.Error(), expect)
+	}
+}
@@ -66,7 +66,7 @@ func ExampleGetBitsAsByte() {
 	// 0x0f
 }
 
-func ExampleNormalize() {
+func ExampleOffset_Normalize() {
 	off := bit.Offset{Byte: 0, Bit: 17}
 
 	fmt.Printf("Offset: Byte:%d Bit:%d\n", off.Byte, off.Bit)
@@ -0,0 +1,211 @@
+/*
+   Copyright 2020 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package bit
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"github.com/goccy/go-reflect"
+	"strings"
+)
+
+// FieldInfo is the position of a field. See Layout.
+type FieldInfo struct {
+	Path      string   /* the dotted path of the field. e.g. Hdr.Options[2].Len */
+	Type      string   /* the Go type of the field */
+	Offset    Offset   /* the offset from the start of the value */
+	BitSize   int      /* the size of the field in bits */
+	ByteOrder string   /* "BE" or "LE". empty means the byte order passed to Read */
+	BitOrder  string   /* "msb" or "lsb". empty means the bit order of the byte order */
+	Tags      []string /* the items of the struct tag */
+}
+
+// MarshalJSON encodes the field as JSON object.
+//   {"path":"Hdr.Len","type":"uint8","offset":{"byte":1,"bit":4},"bits":4,"byteOrder":"BE","bitOrder":"lsb","tags":["bits=4","lsb"]}
+func (f FieldInfo) MarshalJSON() ([]byte, error) {
+	type offset struct {
+		Byte uint64 `json:"byte"`
+		Bit  uint64 `json:"bit"`
+	}
+	return json.Marshal(struct {
+		Path      string   `json:"path"`
+		Type      string   `json:"type"`
+		Offset    offset   `json:"offset"`
+		BitSize   int      `json:"bits"`
+		ByteOrder string   `json:"byteOrder,omitempty"`
+		BitOrder  string   `json:"bitOrder,omitempty"`
+		Tags      []string `json:"tags,omitempty"`
+	}{f.Path, f.Type, offset{f.Offset.Byte, f.Offset.Bit}, f.BitSize, f.ByteOrder, f.BitOrder, f.Tags})
+}
+
+// Layout returns the position of each field of v in the order of the fields.
+// The position is computed from v in the same manner as Read and Write.
+// e.g. the size of `bit:"len=Name"` slice is the length of the slice, and `bit:"if=Cond"` field is omitted if Cond is false.
+// A struct and an array of struct are followed by their fields and elements.
+// Ignored field by `bit:"-"` is omitted. Skipped field by `bit:"skip"` and not exported field are included.
+func Layout(v interface{}) ([]FieldInfo, error) {
+	var l layout
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	if _, err := l.value(rv, "", 0, nil, orderNames{}); err != nil {
+		return nil, err
+	}
+	return l.fields, nil
+}
+
+// layout collects FieldInfo.
+type layout struct {
+	fields []FieldInfo
+	values []reflect.Value /* the value of each field */
+	cnfs   []*tagConfig    /* the struct tag of each field */
+}
+
+// value adds the value v at pos and its children. It returns the size of v in bits.
+// order is the byte order and the bit order inherited from the parent.
+func (l *layout) value(v reflect.Value, path string, pos uint64, cnf *tagConfig, order orderNames) (int, error) {
+	order = orderName(cnf, order)
+	idx := len(l.fields)
+	if path != "" {
+		l.fields = append(l.fields, FieldInfo{Path: path, Type: v.Type().String(), ByteOrder: order.byteOrder, BitOrder: order.bitOrder})
+		l.values = append(l.values, v)
+		l.cnfs = append(l.cnfs, cnf)
+	}
+	size, err := l.children(v, path, pos, cnf, order)
+	if err != nil {
+		return 0, err
+	}
+	if path != "" {
+		l.fields[idx].Offset = Offset{Bit: pos}
+		l.fields[idx].Offset.Normalize()
+		l.fields[idx].BitSize = size
+	}
+	return size, nil
+}
+
+// children adds the fields or the elements of v. It returns the size of v in bits.
+func (l *layout) children(v reflect.Value, path string, pos uint64, cnf *tagConfig, order orderNames) (int, error) {
+	if cnf != nil && (cnf.skip || cnf.bits > 0 || cnf.str != nil || cnf.fixed != nil || cnf.scale != nil) {
+		return fieldSize(v, cnf), nil
+	}
+	if !v.CanInterface() {
+		/* not exported field is skipped by its static size */
+		if size := planOf(v.Type()).size; size > 0 {
+			return size, nil
+		}
+		return 0, nil
+	}
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			/* nil pointer is treated as the zero value */
+			return l.children(reflect.New(v.Type().Elem()).Elem(), path, pos, cnf, order)
+		}
+		return l.children(v.Elem(), path, pos, cnf, order)
+	}
+	if _, ok := asMarshaler(v); ok {
+		return fieldSize(v, cnf), nil
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		return l.structFields(v, path, pos, order)
+	case reflect.Array, reflect.Slice:
+		switch v.Type().Elem().Kind() {
+		case reflect.Struct, reflect.Array, reflect.Slice, reflect.Ptr, reflect.Interface:
+			var size int
+			for i := 0; i < v.Len(); i++ {
+				n, err := l.value(v.Index(i), fmt.Sprintf("%s[%d]", path, i), pos+uint64(size), nil, order)
+				if err != nil {
+					return 0, err
+				}
+				size += n
+			}
+			return size, nil
+		}
+	case reflect.Interface:
+		e, err := variantValue(v)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", path, err)
+		}
+		return l.children(e, path, pos, nil, order)
+	}
+	return fieldSize(v, cnf), nil
+}
+
+// structFields adds the fields of the struct v at pos.
+func (l *layout) structFields(v reflect.Value, path string, pos uint64, order orderNames) (int, error) {
+	p := planOf(v.Type())
+	if p.err != nil {
+		return 0, &tagError{field: joinPath(path, p.err.field), err: p.err.err}
+	}
+	var rel, end uint64
+	for _, fp := range p.fields {
+		cnf := fp.cnf
+		if cnf != nil && cnf.ignore {
+			continue
+		} else if cnf != nil && cnf.cond != nil {
+			ok, err := cnf.cond.eval(v)
+			if err != nil {
+				return 0, fmt.Errorf("%s: %w", joinPath(path, fp.name), err)
+			} else if !ok {
+				continue
+			}
+		}
+		rel = cnf.place(rel)
+		idx := len(l.fields)
+		size, err := l.value(v.Field(fp.index), joinPath(path, fp.name), pos+rel, cnf, order)
+		if err != nil {
+			return 0, err
+		}
+		if tag := v.Type().Field(fp.index).Tag.Get(tagKeyName); tag != "" {
+			l.fields[idx].Tags = strings.Split(tag, ",")
+		}
+		rel += uint64(size)
+		if rel > end {
+			end = rel
+		}
+	}
+	/* overlapped field by "at=" doesn't increase the size */
+	return int(end), nil
+}
+
+// orderNames is the names of the byte order and the bit order of the field.
+type orderNames struct {
+	byteOrder string /* "BE", "LE" or empty */
+	bitOrder  string /* "msb", "lsb" or empty */
+}
+
+// orderName returns the names of the orders of the field. def is the orders of the parent.
+func orderName(cnf *tagConfig, def orderNames) orderNames {
+	if cnf == nil {
+		return def
+	}
+	switch {
+	case cnf.endian == nil:
+	case cnf.endian == binary.BigEndian:
+		def.byteOrder = "BE"
+	default:
+		def.byteOrder = "LE"
+	}
+	switch {
+	case cnf.bitOrder == nil:
+	case *cnf.bitOrder == MSB0:
+		def.bitOrder = "msb"
+	default:
+		def.bitOrder = "lsb"
+	}
+	return def
+}
@@ -0,0 +1,164 @@
+/*
+   Copyright 2020 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package bit_test
+
+import (
+	"encoding/json"
+	"github.com/nokute78/go-bit/v2"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type layoutTCP struct {
+	SrcPort uint16
+	DstPort uint16
+	Seq     uint32
+	Ack     uint32
+	DataOff uint8 `bit:"bits=4"`
+	_       uint8 `bit:"bits=3"`
+	NS      bit.Bit
+	CWR     bit.Bit
+	ECE     bit.Bit
+	Flags   [6]bit.Bit
+	Window  uint16 `bit:"LE"`
+}
+
+func TestLayout(t *testing.T) {
+	fields, err := bit.Layout(&layoutTCP{})
+	if err != nil {
+		t.Fatalf("Layout error:%s", err)
+	}
+	expect := []bit.FieldInfo{
+		{Path: "SrcPort", Type: "uint16", Offset: bit.Offset{Byte: 0}, BitSize: 16},
+		{Path: "DstPort", Type: "uint16", Offset: bit.Offset{Byte: 2}, BitSize: 16},
+		{Path: "Seq", Type: "uint32", Offset: bit.Offset{Byte: 4}, BitSize: 32},
+		{Path: "Ack", Type: "uint32", Offset: bit.Offset{Byte: 8}, BitSize: 32},
+		{Path: "DataOff", Type: "uint8", Offset: bit.Offset{Byte: 12}, BitSize: 4, Tags: []string{"bits=4"}},
+		{Path: "_", Type: "uint8", Offset: bit.Offset{Byte: 12, Bit: 4}, BitSize: 3, Tags: []string{"bits=3"}},
+		{Path: "NS", Type: "bit.Bit", Offset: bit.Offset{Byte: 12, Bit: 7}, BitSize: 1},
+		{Path: "CWR", Type: "bit.Bit", Offset: bit.Offset{Byte: 13, Bit: 0}, BitSize: 1},
+		{Path: "ECE", Type: "bit.Bit", Offset: bit.Offset{Byte: 13, Bit: 1}, BitSize: 1},
+		{Path: "Flags", Type: "[6]bit.Bit", Offset: bit.Offset{Byte: 13, Bit: 2}, BitSize: 6},
+		{Path: "Window", Type: "uint16", Offset: bit.Offset{Byte: 14}, BitSize: 16, ByteOrder: "LE", Tags: []string{"LE"}},
+	}
+	if !reflect.DeepEqual(fields, expect) {
+		t.Errorf("mismatch\n given =%+v\n expect=%+v", fields, expect)
+	}
+}
+
+func TestLayoutNested(t *testing.T) {
+	type Option struct {
+		Kind uint8
+		Len  uint8 `bit:"bits=4"`
+	}
+	type Header struct {
+		Ver  uint8 `bit:"bits=4"`
+		Ext  bit.Bit
+		N    uint8    `bit:"bits=3"`
+		Opts []Option `bit:"len=N"`
+		Tail uint16   `bit:"if=Ext,at=8"`
+	}
+	type Packet struct {
+		Hdr  Header `bit:"msb"`
+		Body uint8  `bit:"-"`
+		Sum  uint8  `bit:"align=8"`
+	}
+
+	p := Packet{Hdr: Header{Opts: make([]Option, 2)}}
+	fields, err := bit.Layout(p)
+	if err != nil {
+		t.Fatalf("Layout error:%s", err)
+	}
+	type pos struct {
+		path     string
+		offset   bit.Offset
+		size     int
+		bitOrder string
+	}
+	expect := []pos{
+		{"Hdr", bit.Offset{}, 32, "msb"},
+		{"Hdr.Ver", bit.Offset{}, 4, "msb"},
+		{"Hdr.Ext", bit.Offset{Bit: 4}, 1, "msb"},
+		{"Hdr.N", bit.Offset{Bit: 5}, 3, "msb"},
+		{"Hdr.Opts", bit.Offset{Byte: 1}, 24, "msb"},
+		{"Hdr.Opts[0]", bit.Offset{Byte: 1}, 12, "msb"},
+		{"Hdr.Opts[0].Kind", bit.Offset{Byte: 1}, 8, "msb"},
+		{"Hdr.Opts[0].Len", bit.Offset{Byte: 2}, 4, "msb"},
+		{"Hdr.Opts[1]", bit.Offset{Byte: 2, Bit: 4}, 12, "msb"},
+		{"Hdr.Opts[1].Kind", bit.Offset{Byte: 2, Bit: 4}, 8, "msb"},
+		{"Hdr.Opts[1].Len", bit.Offset{Byte: 3, Bit: 4}, 4, "msb"},
+		{"Sum", bit.Offset{Byte: 4}, 8, ""},
+	}
+	if len(fields) != len(expect) {
+		t.Fatalf("len given=%d expect=%d\n %+v", len(fields), len(expect), fields)
+	}
+	for i, e := range expect {
+		f := fields[i]
+		if f.Path != e.path || f.Offset != e.offset || f.BitSize != e.size || f.BitOrder != e.bitOrder || f.ByteOrder != "" {
+			t.Errorf("%d: given=%+v expect=%+v", i, f, e)
+		}
+	}
+
+	/* Tail overlaps Opts */
+	p.Hdr.Ext = true
+	fields, err = bit.Layout(p)
+	if err != nil {
+		t.Fatalf("Layout error:%s", err)
+	}
+	if f := fields[len(fields)-2]; f.Path != "Hdr.Tail" || f.Offset != (bit.Offset{Byte: 1}) || f.BitSize != 16 {
+		t.Errorf("given=%+v", f)
+	}
+	if f := fields[0]; f.BitSize != 32 {
+		t.Errorf("given=%+v", f)
+	}
+}
+
+func TestLayoutTagErrorPath(t *testing.T) {
+	type Bad struct {
+		A uint8 `bit:"bits=x"`
+	}
+	type Outer struct {
+		X uint8
+		B Bad
+	}
+
+	_, err := bit.Layout(&Outer{})
+	if err == nil || !strings.HasPrefix(err.Error(), "B.A: ") {
+		t.Errorf("given=%v", err)
+	}
+}
+
+func TestLayoutJSON(t *testing.T) {
+	type S struct {
+		A uint8 `bit:"bits=4,BE"`
+		B uint16
+	}
+	fields, err := bit.Layout(S{})
+	if err != nil {
+		t.Fatalf("Layout error:%s", err)
+	}
+	b, err := json.Marshal(fields)
+	if err != nil {
+		t.Fatalf("json.Marshal error:%s", err)
+	}
+	expect := `[{"path":"A","type":"uint8","offset":{"byte":0,"bit":0},"bits":4,"byteOrder":"BE","tags":["bits=4","BE"]},` +
+		`{"path":"B","type":"uint16","offset":{"byte":0,"bit":4},"bits":16}]`
+	if string(b) != expect {
+		t.Errorf("mismatch\n given =%s\n expect=%s", b, expect)
+	}
+}
@@ -0,0 +1,174 @@
+/*
+   Copyright 2020 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package bit
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/goccy/go-reflect"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// fixedPoint represents the Q format of "q=" and "uq=" tag.
+//   "q=8.8"   : signed, 8 integer bits (including sign bit) and 8 fractional bits
+//   "uq=4.12" : unsigned, 4 integer bits and 12 fractional bits
+type fixedPoint struct {
+	signed   bool
+	intBits  int
+	fracBits int
+}
+
+func parseFixedPoint(s string, signed bool) (*fixedPoint, error) {
+	strs := strings.Split(s, ".")
+	if len(strs) != 2 {
+		return nil, fmt.Errorf("invalid Q format %q", s)
+	}
+	m, err := strconv.Atoi(strs[0])
+	if err != nil || m < 0 {
+		return nil, fmt.Errorf("invalid Q format %q", s)
+	}
+	n, err := strconv.Atoi(strs[1])
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("invalid Q format %q", s)
+	}
+	if m+n <= 0 || m+n > 64 {
+		return nil, fmt.Errorf("invalid Q format %q: size must be 1-64 bits", s)
+	}
+	return &fixedPoint{signed: signed, intBits: m, fracBits: n}, nil
+}
+
+func (q *fixedPoint) String() string {
+	if q.signed {
+		return fmt.Sprintf("Q%d.%d", q.intBits, q.fracBits)
+	}
+	return fmt.Sprintf("UQ%d.%d", q.intBits, q.fracBits)
+}
+
+// size returns the size in bits.
+func (q *fixedPoint) size() int {
+	return q.intBits + q.fracBits
+}
+
+// toFloat converts raw integer to scaled value.
+func (q *fixedPoint) toFloat(raw uint64) float64 {
+	if q.signed {
+		return math.Ldexp(float64(signExtend(raw, q.size())), -q.fracBits)
+	}
+	return math.Ldexp(float64(raw), -q.fracBits)
+}
+
+// toRaw converts f to raw integer. It rounds f to nearest and saturates it.
+func (q *fixedPoint) toRaw(f float64) (uint64, error) {
+	if math.IsNaN(f) {
+		return 0, fmt.Errorf("NaN cannot be converted to %s", q)
+	}
+	size := q.size()
+	mask := ^uint64(0) >> uint(64-size)
+	x := math.Round(math.Ldexp(f, q.fracBits))
+
+	if q.signed {
+		max := int64(mask >> 1)
+		min := -max - 1
+		lim := math.Ldexp(1, size-1)
+		var i int64
+		switch {
+		case x >= lim:
+			i = max
+		case x < -lim:
+			i = min
+		default:
+			i = int64(x)
+		}
+		return uint64(i) & mask, nil
+	}
+
+	switch {
+	case x <= 0:
+		return 0, nil
+	case x >= math.Ldexp(1, size):
+		return mask, nil
+	}
+	return uint64(x), nil
+}
+
+// checkFixedField checks if v can be treated as fixed-point number.
+func checkFixedField(v reflect.Value, q *fixedPoint) error {
+	switch v.Kind() {
+	case reflect.Float32, reflect.Float64:
+		return nil
+	}
+	return fmt.Errorf("%s is %w for %s", q, ErrUnsupportedType, v.Kind())
+}
+
+// readFixed reads Q format number and fills v as float.
+func readFixed(s *source, order binary.ByteOrder, v reflect.Value, o *Offset, q *fixedPoint) error {
+	var err error
+	bitSize := q.size()
+	if !v.CanSet() {
+		// skip unexported field
+		*o, err = o.AddOffset(Offset{Bit: uint64(bitSize)})
+		if err != nil {
+			return err
+		}
+		return errCannotInterface
+	}
+	if err := checkFixedField(v, q); err != nil {
+		return err
+	}
+
+	if err := s.ensure(*o, uint64(bitSize)); err != nil {
+		return err
+	}
+	ret, err := getUint(s.b, *o, bitSize, order)
+	if err != nil {
+		return err
+	}
+	v.SetFloat(q.toFloat(ret))
+
+	*o, err = o.AddOffset(Offset{Bit: uint64(bitSize)})
+	return err
+}
+
+// writeFixed writes float v to b as Q format number.
+func writeFixed(v reflect.Value, order binary.ByteOrder, b []byte, o *Offset, q *fixedPoint) error {
+	var err error
+	bitSize := q.size()
+	if !v.CanInterface() {
+		// skip unexported field
+		*o, err = o.AddOffset(Offset{Bit: uint64(bitSize)})
+		if err != nil {
+			return err
+		}
+		return errCannotInterface
+	}
+	if err := checkFixedField(v, q); err != nil {
+		return err
+	}
+
+	val, err := q.toRaw(v.Float())
+	if err != nil {
+		return err
+	}
+	if err := putUint(b, *o, val, bitSize, order); err != nil {
+		return err
+	}
+
+	*o, err = o.AddOffset(Offset{Bit: uint64(bitSize)})
+	return err
+}
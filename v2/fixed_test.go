@@ -0,0 +1,148 @@
+/*
+   Copyright 2020 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package bit_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/nokute78/go-bit/v2"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestReadFixedPoint(t *testing.T) {
+	type Q struct {
+		Q88   float64 `bit:"q=8.8"`
+		UQ412 float64 `bit:"uq=4.12"`
+		Q115  float32 `bit:"q=1.15"`
+	}
+	type testcase struct {
+		name   string
+		input  []byte
+		order  binary.ByteOrder
+		expect Q
+	}
+
+	cases := []testcase{
+		{"BE", []byte{0x01, 0x80, 0x18, 0x00, 0x40, 0x00}, binary.BigEndian, Q{1.5, 1.5, 0.5}},
+		{"LE", []byte{0x80, 0x01, 0x00, 0x18, 0x00, 0x40}, binary.LittleEndian, Q{1.5, 1.5, 0.5}},
+		{"negative", []byte{0xff, 0x80, 0xff, 0xff, 0x80, 0x00}, binary.BigEndian, Q{-0.5, 16 - 1.0/4096, -1}},
+	}
+
+	for _, v := range cases {
+		var q Q
+		if err := bit.Read(bytes.NewReader(v.input), v.order, &q); err != nil {
+			t.Errorf("%s: bit.Read error:%s", v.name, err)
+			continue
+		}
+		if q != v.expect {
+			t.Errorf("%s: given=%+v expect=%+v", v.name, q, v.expect)
+		}
+	}
+}
+
+func TestReadFixedPointNotAligned(t *testing.T) {
+	type Q struct {
+		A float64 `bit:"q=3.2"`
+		B uint8   `bit:"bits=3"`
+	}
+	var q Q
+	/* A = 0b10110 (-2.5), B = 0b101 */
+	if _, err := bit.Unmarshal([]byte{0xb5}, bit.Offset{}, binary.BigEndian, &q); err != nil {
+		t.Fatalf("bit.Unmarshal error:%s", err)
+	}
+	if q.A != -2.5 || q.B != 5 {
+		t.Errorf("given=%+v", q)
+	}
+
+	if size, err := bit.SizeOf(reflect.TypeOf(q)); err != nil || size != 8 {
+		t.Errorf("SizeOf: given=%d err=%v", size, err)
+	}
+
+	b, _, err := bit.Marshal(q, binary.BigEndian)
+	if err != nil {
+		t.Fatalf("bit.Marshal error:%s", err)
+	}
+	if !bytes.Equal(b, []byte{0xb5}) {
+		t.Errorf("bit.Marshal: given=%x expect=b5", b)
+	}
+}
+
+func TestWriteFixedPoint(t *testing.T) {
+	type Q struct {
+		Q88   float64 `bit:"q=8.8"`
+		UQ412 float64 `bit:"uq=4.12"`
+	}
+	type testcase struct {
+		name   string
+		input  Q
+		expect []byte
+	}
+
+	cases := []testcase{
+		{"exact", Q{1.5, 1.5}, []byte{0x01, 0x80, 0x18, 0x00}},
+		{"round", Q{1.002, 1.0 / 8192}, []byte{0x01, 0x01, 0x00, 0x01}},
+		{"saturate max", Q{200, 16}, []byte{0x7f, 0xff, 0xff, 0xff}},
+		{"saturate min", Q{-200, -1}, []byte{0x80, 0x00, 0x00, 0x00}},
+		{"inf", Q{math.Inf(1), math.Inf(-1)}, []byte{0x7f, 0xff, 0x00, 0x00}},
+	}
+
+	for _, v := range cases {
+		b := new(bytes.Buffer)
+		if err := bit.Write(b, binary.BigEndian, v.input); err != nil {
+			t.Errorf("%s: bit.Write error:%s", v.name, err)
+			continue
+		}
+		if !bytes.Equal(b.Bytes(), v.expect) {
+			t.Errorf("%s: given=%x expect=%x", v.name, b.Bytes(), v.expect)
+		}
+	}
+}
+
+func TestFixedPointError(t *testing.T) {
+	type Int struct {
+		A int16 `bit:"q=8.8"`
+	}
+	var i Int
+	if err := bit.Read(bytes.NewReader([]byte{0, 0}), binary.LittleEndian, &i); err == nil {
+		t.Errorf("Read should fail for int field")
+	}
+
+	type Bits struct {
+		A float64 `bit:"q=8.8,bits=16"`
+	}
+	var b Bits
+	if err := bit.Read(bytes.NewReader([]byte{0, 0}), binary.LittleEndian, &b); err == nil {
+		t.Errorf("Read should fail for q= and bits=")
+	}
+
+	type Invalid struct {
+		A float64 `bit:"q=40.40"`
+	}
+	var inv Invalid
+	if err := bit.Read(bytes.NewReader(make([]byte, 10)), binary.LittleEndian, &inv); err == nil {
+		t.Errorf("Read should fail for invalid format")
+	}
+
+	type Q struct {
+		A float64 `bit:"q=8.8"`
+	}
+	if err := bit.Write(new(bytes.Buffer), binary.LittleEndian, Q{math.NaN()}); err == nil {
+		t.Errorf("Write should fail for NaN")
+	}
+}
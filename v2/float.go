@@ -0,0 +1,123 @@
+/*
+   Copyright 2020 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package bit
+
+import (
+	"fmt"
+	"math"
+)
+
+// Float16 represents IEEE 754 half precision floating point number.
+// It is read/written as 16 bits value.
+type Float16 uint16
+
+// NewFloat16 converts f to Float16.
+// The value is rounded to nearest even.
+func NewFloat16(f float32) Float16 {
+	b := math.Float32bits(f)
+	sign := uint16(b>>16) & 0x8000
+	exp := int(b>>23) & 0xff
+	mant := b & 0x7fffff
+
+	if exp == 0xff {
+		/* Inf or NaN */
+		if mant != 0 {
+			return Float16(sign | 0x7e00)
+		}
+		return Float16(sign | 0x7c00)
+	}
+
+	e := exp - 127 + 15
+	if e >= 0x1f {
+		/* overflow */
+		return Float16(sign | 0x7c00)
+	} else if e <= 0 {
+		/* subnormal */
+		if e < -10 {
+			return Float16(sign)
+		}
+		return Float16(sign | uint16(roundShift(mant|0x800000, uint(14-e))))
+	}
+	/* carry of mantissa may update exponent */
+	return Float16(sign | (uint16(e)<<10 + uint16(roundShift(mant, 13))))
+}
+
+// roundShift shifts v to right and rounds it to nearest even.
+func roundShift(v uint32, shift uint) uint32 {
+	half := uint32(1) << (shift - 1)
+	ret := v >> shift
+	rem := v & (1<<shift - 1)
+	if rem > half || (rem == half && ret&1 == 1) {
+		ret++
+	}
+	return ret
+}
+
+// Float32 converts f to float32.
+func (f Float16) Float32() float32 {
+	sign := uint32(f&0x8000) << 16
+	exp := uint32(f>>10) & 0x1f
+	mant := uint32(f) & 0x3ff
+
+	switch exp {
+	case 0x1f:
+		/* Inf or NaN */
+		return math.Float32frombits(sign | 0x7f800000 | mant<<13)
+	case 0:
+		if mant == 0 {
+			return math.Float32frombits(sign)
+		}
+		/* subnormal */
+		e := uint32(127 - 15 + 1)
+		for mant&0x400 == 0 {
+			mant <<= 1
+			e--
+		}
+		mant &= 0x3ff
+		return math.Float32frombits(sign | e<<23 | mant<<13)
+	}
+	return math.Float32frombits(sign | (exp+127-15)<<23 | mant<<13)
+}
+
+func (f Float16) String() string {
+	return fmt.Sprint(f.Float32())
+}
+
+// BFloat16 represents bfloat16 (brain floating point) number.
+// It is the upper 16 bits of float32.
+type BFloat16 uint16
+
+// NewBFloat16 converts f to BFloat16.
+// The value is rounded to nearest even.
+func NewBFloat16(f float32) BFloat16 {
+	b := math.Float32bits(f)
+	if b&0x7fffffff > 0x7f800000 {
+		/* NaN. keep it quiet NaN */
+		return BFloat16(b>>16 | 0x40)
+	}
+	b += 0x7fff + (b>>16)&1
+	return BFloat16(b >> 16)
+}
+
+// Float32 converts f to float32.
+func (f BFloat16) Float32() float32 {
+	return math.Float32frombits(uint32(f) << 16)
+}
+
+func (f BFloat16) String() string {
+	return fmt.Sprint(f.Float32())
+}
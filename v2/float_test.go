@@ -0,0 +1,97 @@
+/*
+   Copyright 2020 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package bit_test
+
+import (
+	"github.com/nokute78/go-bit/v2"
+	"math"
+	"testing"
+)
+
+func TestFloat16(t *testing.T) {
+	type testcase struct {
+		name   string
+		input  float32
+		expect bit.Float16
+	}
+
+	cases := []testcase{
+		{"zero", 0, 0x0000},
+		{"negative zero", float32(math.Copysign(0, -1)), 0x8000},
+		{"one", 1, 0x3c00},
+		{"minus two", -2, 0xc000},
+		{"max", 65504, 0x7bff},
+		{"overflow", 65520, 0x7c00},
+		{"min normal", 6.1035156e-05, 0x0400},
+		{"min subnormal", 5.9604645e-08, 0x0001},
+		{"underflow", 1e-10, 0x0000},
+		{"round", 0.1, 0x2e66},
+		{"inf", float32(math.Inf(1)), 0x7c00},
+		{"-inf", float32(math.Inf(-1)), 0xfc00},
+	}
+
+	for _, v := range cases {
+		ret := bit.NewFloat16(v.input)
+		if ret != v.expect {
+			t.Errorf("%s: given=0x%04x expect=0x%04x", v.name, uint16(ret), uint16(v.expect))
+		}
+		if v.name == "overflow" || v.name == "underflow" || v.name == "round" {
+			continue
+		}
+		if f := ret.Float32(); f != v.input {
+			t.Errorf("%s: Float32 given=%v expect=%v", v.name, f, v.input)
+		}
+	}
+
+	nan := bit.NewFloat16(float32(math.NaN()))
+	if f := nan.Float32(); !math.IsNaN(float64(f)) {
+		t.Errorf("NaN: given=%v", f)
+	}
+}
+
+func TestBFloat16(t *testing.T) {
+	type testcase struct {
+		name   string
+		input  float32
+		expect bit.BFloat16
+	}
+
+	cases := []testcase{
+		{"zero", 0, 0x0000},
+		{"one", 1, 0x3f80},
+		{"minus two", -2, 0xc000},
+		{"pi", math.Pi, 0x4049},
+		{"round up", 1.00390625 + 1.0/1024, 0x3f81},
+		{"inf", float32(math.Inf(1)), 0x7f80},
+	}
+
+	for _, v := range cases {
+		ret := bit.NewBFloat16(v.input)
+		if ret != v.expect {
+			t.Errorf("%s: given=0x%04x expect=0x%04x", v.name, uint16(ret), uint16(v.expect))
+		}
+	}
+
+	if f := bit.BFloat16(0x4049).Float32(); f != 3.140625 {
+		t.Errorf("Float32: given=%v expect=3.140625", f)
+	}
+
+	nan := bit.NewBFloat16(float32(math.NaN()))
+	if f := nan.Float32(); !math.IsNaN(float64(f)) {
+		t.Errorf("NaN: given=%v", f)
+	}
+}
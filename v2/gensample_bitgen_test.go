@@ -0,0 +1,176 @@
+// Code generated by "bitgen -type=genSample -output=gensample_bitgen_test.go bitgen_test.go"; DO NOT EDIT.
+
+package bit_test
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+
+	"github.com/nokute78/go-bit/v2"
+)
+
+// UnmarshalBits implements bit.BitUnmarshaler.
+func (s *genSample) UnmarshalBits(r *bit.Reader) error {
+	order := r.ByteOrder()
+	{
+		v, err := r.ReadUint8()
+		if err != nil {
+			return err
+		}
+		s.A = v
+	}
+	r.SetByteOrder(binary.BigEndian)
+	{
+		v, err := r.ReadUint16()
+		if err != nil {
+			return err
+		}
+		s.B = int16(v)
+	}
+	r.SetByteOrder(order)
+	{
+		v, err := r.ReadBits(5)
+		if err != nil {
+			return err
+		}
+		s.C = uint32(v)
+	}
+	{
+		v, err := r.ReadBits(3)
+		if err != nil {
+			return err
+		}
+		s.D = int8(int64(v<<61) >> 61)
+	}
+	{
+		v, err := r.ReadBits(6)
+		if err != nil {
+			return err
+		}
+		for i := range s.E {
+			s.E[i] = v>>uint(i)&1 == 1
+		}
+	}
+	{
+		v, err := r.ReadBit()
+		if err != nil {
+			return err
+		}
+		s.F = v
+	}
+	if err := r.Skip(3); err != nil {
+		return err
+	}
+	{
+		v, err := r.ReadUint32()
+		if err != nil {
+			return err
+		}
+		s.G = math.Float32frombits(v)
+	}
+	{
+		v, err := r.ReadUint16()
+		if err != nil {
+			return err
+		}
+		s.H = bit.Float16(v)
+	}
+	r.SetByteOrder(binary.LittleEndian)
+	{
+		v, err := r.ReadUint64()
+		if err != nil {
+			return err
+		}
+		s.I = v
+	}
+	r.SetByteOrder(order)
+	if err := r.Read(&s.J); err != nil {
+		return err
+	}
+	if err := r.Skip(16); err != nil {
+		return err
+	}
+	{
+		v, err := r.ReadBits(40)
+		if err != nil {
+			return err
+		}
+		s.L = int64(v<<24) >> 24
+	}
+	return nil
+}
+
+// MarshalBits implements bit.BitMarshaler.
+func (s genSample) MarshalBits(w *bit.Writer) error {
+	order := w.ByteOrder()
+	if err := w.WriteUint8(s.A); err != nil {
+		return err
+	}
+	w.SetByteOrder(binary.BigEndian)
+	if err := w.WriteUint16(uint16(s.B)); err != nil {
+		return err
+	}
+	w.SetByteOrder(order)
+	if err := w.WriteBits(uint64(s.C), 5); err != nil {
+		return err
+	}
+	{
+		v := int64(s.D)
+		if v < -4 || v > 3 {
+			return fmt.Errorf("D: %d overflows 3 bits", v)
+		}
+		if err := w.WriteBits(uint64(v)&0x7, 3); err != nil {
+			return err
+		}
+	}
+	{
+		var v uint64
+		for i, b := range s.E {
+			if b {
+				v |= 1 << uint(i)
+			}
+		}
+		if err := w.WriteBits(v, 6); err != nil {
+			return err
+		}
+	}
+	if err := w.WriteBit(s.F); err != nil {
+		return err
+	}
+	if err := w.Skip(3); err != nil {
+		return err
+	}
+	if err := w.WriteUint32(math.Float32bits(s.G)); err != nil {
+		return err
+	}
+	if err := w.WriteUint16(uint16(s.H)); err != nil {
+		return err
+	}
+	w.SetByteOrder(binary.LittleEndian)
+	if err := w.WriteUint64(s.I); err != nil {
+		return err
+	}
+	w.SetByteOrder(order)
+	if err := w.Write(s.J); err != nil {
+		return err
+	}
+	if err := w.Skip(16); err != nil {
+		return err
+	}
+	{
+		v := int64(s.L)
+		if v < -549755813888 || v > 549755813887 {
+			return fmt.Errorf("L: %d overflows 40 bits", v)
+		}
+		if err := w.WriteBits(uint64(v)&0xffffffffff, 40); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// BitSize implements bit.BitMarshaler.
+func (s genSample) BitSize() int {
+	return 242
+}
@@ -5,4 +5,5 @@ go 1.14
 require (
 	github.com/goccy/go-reflect v1.1.0
 	github.com/mattn/go-isatty v0.0.8
+	gopkg.in/yaml.v2 v2.4.0
 )
@@ -0,0 +1,77 @@
+/*
+   Copyright 2020 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package bit
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseAt parses the value of "at=" tag.
+//   "at=N"   : N bits from the start of the struct
+//   "at=N.M" : N bytes and M bits from the start of the struct
+func parseAt(s string) (*Offset, error) {
+	strs := strings.SplitN(s, ".", 2)
+	n, err := strconv.ParseUint(strs[0], 0, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tag at=%s", s)
+	}
+	if len(strs) == 1 {
+		ret := Offset{Bit: n}
+		ret.Normalize()
+		return &ret, nil
+	}
+	m, err := strconv.ParseUint(strs[1], 0, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tag at=%s", s)
+	}
+	ret := Offset{Byte: n, Bit: m}
+	ret.Normalize()
+	return &ret, nil
+}
+
+// hasLayout returns true if the field has "at=", "pad=" or "align=" tag.
+func (cnf *tagConfig) hasLayout() bool {
+	return cnf != nil && !cnf.ignore && (cnf.at != nil || cnf.pad > 0 || cnf.align > 0)
+}
+
+// place returns the position of the field in bits.
+// pos is the current position relative to the start of the struct.
+func (cnf *tagConfig) place(pos uint64) uint64 {
+	if !cnf.hasLayout() {
+		return pos
+	}
+	if cnf.at != nil {
+		pos = cnf.at.Bits()
+	}
+	pos += uint64(cnf.pad)
+	if align := uint64(cnf.align); align > 0 && pos%align != 0 {
+		pos += align - pos%align
+	}
+	return pos
+}
+
+// moveTo updates o to the position of the field. base is the start of the struct.
+func (cnf *tagConfig) moveTo(base Offset, o *Offset) error {
+	if !cnf.hasLayout() {
+		return nil
+	}
+	var err error
+	*o, err = base.AddOffset(Offset{Bit: cnf.place(o.Bits() - base.Bits())})
+	return err
+}
@@ -0,0 +1,136 @@
+/*
+   Copyright 2020 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package bit_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/nokute78/go-bit/v2"
+	"reflect"
+	"testing"
+)
+
+func TestAlignTag(t *testing.T) {
+	type S struct {
+		A uint8  `bit:"bits=3"`
+		B uint8  `bit:"align=8"`
+		C uint16 `bit:"align=32"`
+		D uint8  `bit:"bits=1,pad=3"`
+	}
+	input := []byte{0xa0, 0x11, 0xff, 0xff, 0x12, 0x34, 0x10}
+	expect := S{A: 5, B: 0x11, C: 0x1234, D: 1}
+
+	var s S
+	if err := bit.Read(bytes.NewReader(input), binary.BigEndian, &s); err != nil {
+		t.Fatalf("bit.Read error:%s", err)
+	}
+	if s != expect {
+		t.Errorf("given=%+v expect=%+v", s, expect)
+	}
+
+	if size, err := bit.SizeOf(reflect.TypeOf(s)); err != nil || size != 52 {
+		t.Errorf("SizeOf: given=%d err=%v", size, err)
+	}
+
+	b, _, err := bit.Marshal(s, binary.BigEndian)
+	if err != nil {
+		t.Fatalf("bit.Marshal error:%s", err)
+	}
+	/* padding is not filled */
+	out := []byte{0xa0, 0x11, 0x00, 0x00, 0x12, 0x34, 0x10}
+	if !bytes.Equal(b, out) {
+		t.Errorf("bit.Marshal: given=%x expect=%x", b, out)
+	}
+}
+
+func TestAlignTagDynamic(t *testing.T) {
+	type S struct {
+		Name string `bit:"cstr"`
+		A    uint32 `bit:"align=32"`
+	}
+	input := []byte{'a', 'b', 0, 0xff, 0x01, 0x02, 0x03, 0x04}
+	expect := S{"ab", 0x01020304}
+
+	var s S
+	br := bytes.NewReader(input)
+	if err := bit.Read(br, binary.BigEndian, &s); err != nil {
+		t.Fatalf("bit.Read error:%s", err)
+	}
+	if s != expect {
+		t.Errorf("given=%+v expect=%+v", s, expect)
+	}
+	if size := bit.Size(s); size != 64 {
+		t.Errorf("Size: given=%d expect=64", size)
+	}
+}
+
+func TestAtTag(t *testing.T) {
+	type Inner struct {
+		Raw     uint32
+		Version uint8  `bit:"at=0,bits=4"`
+		Length  uint16 `bit:"at=2.0"`
+	}
+	type S struct {
+		Head  uint8
+		Inner Inner
+		Tail  uint8
+	}
+	input := []byte{0xaa, 0x45, 0x00, 0x00, 0x14, 0xbb}
+	expect := S{Head: 0xaa, Inner: Inner{Raw: 0x45000014, Version: 4, Length: 0x14}, Tail: 0xbb}
+
+	var s S
+	if err := bit.Read(bytes.NewReader(input), binary.BigEndian, &s); err != nil {
+		t.Fatalf("bit.Read error:%s", err)
+	}
+	if s != expect {
+		t.Errorf("given=%+v expect=%+v", s, expect)
+	}
+
+	/* view fields don't increase the size */
+	if size, err := bit.SizeOf(reflect.TypeOf(s)); err != nil || size != 48 {
+		t.Errorf("SizeOf: given=%d err=%v", size, err)
+	}
+
+	/* the last field wins */
+	s.Inner.Raw = 0
+	b, _, err := bit.Marshal(s, binary.BigEndian)
+	if err != nil {
+		t.Fatalf("bit.Marshal error:%s", err)
+	}
+	out := []byte{0xaa, 0x40, 0x00, 0x00, 0x14, 0xbb}
+	if !bytes.Equal(b, out) {
+		t.Errorf("bit.Marshal: given=%x expect=%x", b, out)
+	}
+}
+
+func TestLayoutTagInvalid(t *testing.T) {
+	type Align struct {
+		A uint8 `bit:"align=0"`
+	}
+	type Pad struct {
+		A uint8 `bit:"pad=x"`
+	}
+	type At struct {
+		A uint8 `bit:"at=1.x"`
+	}
+
+	for _, v := range []interface{}{&Align{}, &Pad{}, &At{}} {
+		if err := bit.Read(bytes.NewReader(make([]byte, 4)), binary.BigEndian, v); err == nil {
+			t.Errorf("%T: Read should fail", v)
+		}
+	}
+}
@@ -0,0 +1,300 @@
+/*
+   Copyright 2020 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package bit
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/goccy/go-reflect"
+)
+
+// BitUnmarshaler is the interface implemented by types that can decode themselves.
+// Read calls UnmarshalBits instead of decoding the value by reflection.
+type BitUnmarshaler interface {
+	UnmarshalBits(r *Reader) error
+}
+
+// BitMarshaler is the interface implemented by types that can encode themselves.
+// Write calls MarshalBits instead of encoding the value by reflection.
+// BitSize returns the size of encoded value in bits.
+type BitMarshaler interface {
+	BitSize() int
+	MarshalBits(w *Writer) error
+}
+
+var (
+	unmarshalerType = reflect.TypeOf((*BitUnmarshaler)(nil)).Elem()
+	marshalerType   = reflect.TypeOf((*BitMarshaler)(nil)).Elem()
+)
+
+// asUnmarshaler returns BitUnmarshaler if v or pointer to v implements it.
+func asUnmarshaler(v reflect.Value) (BitUnmarshaler, bool) {
+	if v.CanAddr() && v.Addr().CanInterface() {
+		if u, ok := v.Addr().Interface().(BitUnmarshaler); ok {
+			return u, true
+		}
+	}
+	if v.CanInterface() && v.Kind() == reflect.Ptr && !v.IsNil() {
+		u, ok := v.Interface().(BitUnmarshaler)
+		return u, ok
+	}
+	return nil, false
+}
+
+// asMarshaler returns BitMarshaler if v or pointer to v implements it.
+func asMarshaler(v reflect.Value) (BitMarshaler, bool) {
+	if !v.CanInterface() {
+		return nil, false
+	}
+	if m, ok := v.Interface().(BitMarshaler); ok {
+		return m, true
+	}
+	if v.CanAddr() {
+		m, ok := v.Addr().Interface().(BitMarshaler)
+		return m, ok
+	}
+	return nil, false
+}
+
+// Reader reads bits from the data which is being decoded.
+// It is passed to BitUnmarshaler.
+type Reader struct {
+	s     *source
+	order binary.ByteOrder
+	off   Offset
+}
+
+// Offset returns current offset.
+func (r *Reader) Offset() Offset {
+	return r.off
+}
+
+// ByteOrder returns the byte order which is used to decode.
+func (r *Reader) ByteOrder() binary.ByteOrder {
+	return r.order
+}
+
+// SetByteOrder changes the byte order which is used by following reads.
+func (r *Reader) SetByteOrder(order binary.ByteOrder) {
+	r.order = order
+}
+
+// Skip skips bitSize bits.
+func (r *Reader) Skip(bitSize int) error {
+	var err error
+	r.off, err = r.off.AddOffset(Offset{Bit: uint64(bitSize)})
+	return err
+}
+
+// readBytes reads byteSize bytes in the same manner as uint field.
+func (r *Reader) readBytes(byteSize int) ([]byte, error) {
+	if err := r.s.ensure(r.off, uint64(byteSize*8)); err != nil {
+		return nil, err
+	}
+	ret, err := getBytes(r.s.b, r.off, byteSize)
+	if err != nil {
+		return nil, err
+	}
+	r.off, err = r.off.AddOffset(Offset{Byte: uint64(byteSize)})
+	return ret, err
+}
+
+// ReadUint8 reads uint8 in the same manner as uint8 field.
+func (r *Reader) ReadUint8() (uint8, error) {
+	b, err := r.readBytes(1)
+	if err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+// ReadUint16 reads uint16 in the same manner as uint16 field.
+func (r *Reader) ReadUint16() (uint16, error) {
+	b, err := r.readBytes(2)
+	if err != nil {
+		return 0, err
+	}
+	return r.order.Uint16(b), nil
+}
+
+// ReadUint32 reads uint32 in the same manner as uint32 field.
+func (r *Reader) ReadUint32() (uint32, error) {
+	b, err := r.readBytes(4)
+	if err != nil {
+		return 0, err
+	}
+	return r.order.Uint32(b), nil
+}
+
+// ReadUint64 reads uint64 in the same manner as uint64 field.
+func (r *Reader) ReadUint64() (uint64, error) {
+	b, err := r.readBytes(8)
+	if err != nil {
+		return 0, err
+	}
+	return r.order.Uint64(b), nil
+}
+
+// ReadBits reads bitSize bits as unsigned integer.
+// The bits are read in the same manner as `bit:"bits=N"` tag.
+func (r *Reader) ReadBits(bitSize int) (uint64, error) {
+	if bitSize <= 0 || bitSize > 64 {
+		return 0, fmt.Errorf("ReadBits: invalid size %d", bitSize)
+	}
+	return readUint(r.s, &r.off, bitSize, r.order)
+}
+
+// ReadBit reads a bit.
+func (r *Reader) ReadBit() (Bit, error) {
+	ret, err := r.ReadBits(1)
+	return ret == 1, err
+}
+
+// Read decodes data in the same manner as Read function.
+// Data must be a pointer.
+func (r *Reader) Read(data interface{}) error {
+	v := reflect.ValueOf(data)
+	if v.Kind() != reflect.Ptr {
+		return fmt.Errorf("Reader.Read: data must be a pointer, %s", v.Kind())
+	}
+	err := read(r.s, r.order, v.Elem(), &r.off)
+	if err != nil && err != errCannotInterface {
+		return err
+	}
+	return nil
+}
+
+// Writer writes bits to the buffer which is being encoded.
+// It is passed to BitMarshaler.
+type Writer struct {
+	b     []byte
+	order binary.ByteOrder
+	off   Offset
+}
+
+// Offset returns current offset.
+func (w *Writer) Offset() Offset {
+	return w.off
+}
+
+// ByteOrder returns the byte order which is used to encode.
+func (w *Writer) ByteOrder() binary.ByteOrder {
+	return w.order
+}
+
+// SetByteOrder changes the byte order which is used by following writes.
+func (w *Writer) SetByteOrder(order binary.ByteOrder) {
+	w.order = order
+}
+
+// Skip skips bitSize bits. The skipped bits are not changed.
+func (w *Writer) Skip(bitSize int) error {
+	var err error
+	w.off, err = w.off.AddOffset(Offset{Bit: uint64(bitSize)})
+	return err
+}
+
+// writeBytes writes b in the same manner as uint field.
+func (w *Writer) writeBytes(b []byte) error {
+	if err := writeBytes(w.b, w.off, b); err != nil {
+		return err
+	}
+	var err error
+	w.off, err = w.off.AddOffset(Offset{Byte: uint64(len(b))})
+	return err
+}
+
+// WriteUint8 writes v in the same manner as uint8 field.
+func (w *Writer) WriteUint8(v uint8) error {
+	return w.writeBytes([]byte{v})
+}
+
+// WriteUint16 writes v in the same manner as uint16 field.
+func (w *Writer) WriteUint16(v uint16) error {
+	b := make([]byte, 2)
+	w.order.PutUint16(b, v)
+	return w.writeBytes(b)
+}
+
+// WriteUint32 writes v in the same manner as uint32 field.
+func (w *Writer) WriteUint32(v uint32) error {
+	b := make([]byte, 4)
+	w.order.PutUint32(b, v)
+	return w.writeBytes(b)
+}
+
+// WriteUint64 writes v in the same manner as uint64 field.
+func (w *Writer) WriteUint64(v uint64) error {
+	b := make([]byte, 8)
+	w.order.PutUint64(b, v)
+	return w.writeBytes(b)
+}
+
+// WriteBits writes lower bitSize bits of val.
+// The bits are written in the same manner as `bit:"bits=N"` tag.
+func (w *Writer) WriteBits(val uint64, bitSize int) error {
+	if bitSize <= 0 || bitSize > 64 {
+		return fmt.Errorf("WriteBits: invalid size %d", bitSize)
+	}
+	return writeUint(w.b, &w.off, val, bitSize, w.order)
+}
+
+// WriteBit writes a bit.
+func (w *Writer) WriteBit(b Bit) error {
+	if b {
+		return w.WriteBits(1, 1)
+	}
+	return w.WriteBits(0, 1)
+}
+
+// Write encodes data in the same manner as Write function.
+func (w *Writer) Write(data interface{}) error {
+	v := reflect.Indirect(reflect.ValueOf(data))
+	err := write(v, w.order, w.b, &w.off)
+	if err != nil && err != errCannotInterface {
+		return err
+	}
+	return nil
+}
+
+// unmarshal decodes v by BitUnmarshaler.
+func unmarshal(u BitUnmarshaler, s *source, order binary.ByteOrder, o *Offset) error {
+	r := &Reader{s: s, order: order, off: *o}
+	if err := u.UnmarshalBits(r); err != nil {
+		return err
+	}
+	*o = r.off
+	return nil
+}
+
+// marshal encodes v by BitMarshaler.
+func marshal(m BitMarshaler, b []byte, order binary.ByteOrder, o *Offset) error {
+	size := m.BitSize()
+	w := &Writer{b: b, order: order, off: *o}
+	if err := m.MarshalBits(w); err != nil {
+		return err
+	}
+	next, err := o.AddOffset(Offset{Bit: uint64(size)})
+	if err != nil {
+		return err
+	}
+	if w.off.Compare(next) > 0 {
+		return fmt.Errorf("MarshalBits wrote %d bits, BitSize=%d", w.off.Bits()-o.Bits(), size)
+	}
+	*o = next
+	return nil
+}
@@ -0,0 +1,102 @@
+/*
+   Copyright 2020 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package bit_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"github.com/nokute78/go-bit/v2"
+	"testing"
+)
+
+// bcdTime is encoded as 3 BCD bytes. e.g. 0x12 0x34 0x56 -> 12:34:56
+type bcdTime struct {
+	Hour, Min, Sec int
+}
+
+func (t *bcdTime) UnmarshalBits(r *bit.Reader) error {
+	var vals [3]int
+	for i := range vals {
+		v, err := r.ReadBits(8)
+		if err != nil {
+			return err
+		}
+		if v>>4 > 9 || v&0xf > 9 {
+			return fmt.Errorf("invalid BCD 0x%x", v)
+		}
+		vals[i] = int(v>>4)*10 + int(v&0xf)
+	}
+	t.Hour, t.Min, t.Sec = vals[0], vals[1], vals[2]
+	return nil
+}
+
+func (t bcdTime) BitSize() int {
+	return 24
+}
+
+func (t bcdTime) MarshalBits(w *bit.Writer) error {
+	for _, v := range []int{t.Hour, t.Min, t.Sec} {
+		if err := w.WriteBits(uint64(v/10<<4|v%10), 8); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestReadUnmarshaler(t *testing.T) {
+	type S struct {
+		Flag bit.Bit
+		Type uint8 `bit:"bits=7"`
+		Time bcdTime
+		Tail uint8
+	}
+
+	var s S
+	br := bytes.NewReader([]byte{0x81, 0x12, 0x34, 0x56, 0xff})
+	if err := bit.Read(br, binary.BigEndian, &s); err != nil {
+		t.Fatalf("error:%s", err)
+	}
+	expect := S{true, 1, bcdTime{12, 34, 56}, 0xff}
+	if s != expect {
+		t.Errorf("given=%+v expect=%+v", s, expect)
+	}
+
+	br = bytes.NewReader([]byte{0x81, 0x1a, 0x34, 0x56, 0xff})
+	if err := bit.Read(br, binary.BigEndian, &s); err == nil {
+		t.Errorf("error is not returned")
+	}
+}
+
+func TestWriteMarshaler(t *testing.T) {
+	type S struct {
+		Flag bit.Bit
+		Type uint8 `bit:"bits=7"`
+		Time bcdTime
+		Tail uint8
+	}
+
+	s := S{true, 1, bcdTime{12, 34, 56}, 0xff}
+	buf := bytes.NewBuffer([]byte{})
+	if err := bit.Write(buf, binary.BigEndian, s); err != nil {
+		t.Fatalf("bit.Write err=%s", err)
+	}
+	expect := []byte{0x81, 0x12, 0x34, 0x56, 0xff}
+	if bytes.Compare(buf.Bytes(), expect) != 0 {
+		t.Errorf("mismatch\n given =%x\n expect=%x", buf.Bytes(), expect)
+	}
+}
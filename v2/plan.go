@@ -0,0 +1,216 @@
+/*
+   Copyright 2020 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package bit
+
+import (
+	"fmt"
+	"github.com/goccy/go-reflect"
+	stdreflect "reflect"
+	"sync"
+)
+
+// fieldPlan is the compiled information of a struct field.
+type fieldPlan struct {
+	index    int
+	name     string
+	exported bool
+	cnf      *tagConfig /* nil if the field has no struct tag */
+}
+
+// typePlan is the compiled information of a type.
+// It is cached per type since parsing struct tags by reflection is expensive.
+type typePlan struct {
+	fields []fieldPlan /* only for struct */
+	err    *tagError   /* error of parsing struct tags */
+	size   int         /* size in bits. -1 if the size is not fixed */
+
+	checksum bool /* true if the struct has checksum field */
+}
+
+// tagError is the error of parsing the struct tag of the field.
+type tagError struct {
+	field string
+	err   error
+}
+
+func (e *tagError) Error() string {
+	return fmt.Sprintf("%s: %s", e.field, e.err)
+}
+
+func (e *tagError) Unwrap() error {
+	return e.err
+}
+
+var plans sync.Map /* reflect.Type -> *typePlan */
+
+// planOf returns the cached plan of t.
+func planOf(t reflect.Type) *typePlan {
+	return planOfVisiting(t, nil)
+}
+
+// planOfVisiting returns the cached plan of t.
+// visiting holds the types being compiled to detect recursive types. e.g. type Node struct{ Next *Node }
+func planOfVisiting(t reflect.Type, visiting map[reflect.Type]bool) *typePlan {
+	if p, ok := plans.Load(t); ok {
+		return p.(*typePlan)
+	}
+	if visiting[t] {
+		/* recursive type. the size is not fixed. */
+		return &typePlan{size: -1}
+	}
+	if visiting == nil {
+		visiting = map[reflect.Type]bool{}
+	}
+	visiting[t] = true
+	compiled := compilePlan(t, visiting)
+	delete(visiting, t)
+
+	p, _ := plans.LoadOrStore(t, compiled)
+	return p.(*typePlan)
+}
+
+func compilePlan(t reflect.Type, visiting map[reflect.Type]bool) *typePlan {
+	p := &typePlan{}
+	if reflect.PtrTo(t).Implements(unmarshalerType) || reflect.PtrTo(t).Implements(marshalerType) {
+		/* the size is decided by the value */
+		p.size = -1
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		p.fields = make([]fieldPlan, t.NumField())
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			cnf, err := parseStructTag(f.Tag)
+			if err != nil {
+				p.err = &tagError{field: f.Name, err: err}
+				p.size = -1
+				return p
+			}
+			if cnf != nil && cnf.reverse && !canReverse(f.Type) {
+				p.err = &tagError{field: f.Name, err: fmt.Errorf("reverse is %w for %s", ErrUnsupportedType, f.Type)}
+				p.size = -1
+				return p
+			}
+			p.fields[i] = fieldPlan{index: i, name: f.Name, exported: f.PkgPath == "", cnf: cnf}
+		}
+		p.checksum = hasChecksum(p.fields)
+		if p.size < 0 {
+			return p
+		}
+		var pos, end uint64
+		for _, fp := range p.fields {
+			size := fp.staticSize(t.Field(fp.index).Type, visiting)
+			if size < 0 {
+				p.size = -1
+				return p
+			}
+			pos = fp.cnf.place(pos) + uint64(size)
+			if pos > end {
+				end = pos
+			}
+		}
+		/* overlapped field by "at=" doesn't increase the size */
+		p.size = int(end)
+	case reflect.Array:
+		if p.size < 0 {
+			return p
+		}
+		elem := planOfVisiting(t.Elem(), visiting).size
+		if elem < 0 {
+			p.size = -1
+			return p
+		}
+		p.size = elem * t.Len()
+	case reflect.Ptr:
+		/* nil pointer is treated as the zero value */
+		if p.size == 0 {
+			p.size = planOfVisiting(t.Elem(), visiting).size
+		}
+	case reflect.Bool:
+		if p.size == 0 {
+			p.size = 1
+		}
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uint,
+		reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Int,
+		reflect.Float32, reflect.Float64:
+		if p.size == 0 {
+			p.size = t.Bits()
+		}
+	default:
+		/* slice, interface and so on */
+		p.size = -1
+	}
+	return p
+}
+
+// staticSize returns the size of the field in bits. It returns -1 if the size is not fixed.
+func (fp fieldPlan) staticSize(t reflect.Type, visiting map[reflect.Type]bool) int {
+	cnf := fp.cnf
+	if cnf == nil {
+		return planOfVisiting(t, visiting).size
+	}
+	switch {
+	case cnf.ignore:
+		return 0
+	case cnf.cond != nil, cnf.lenField != "", cnf.sizeField != "", cnf.switchField != "":
+		return -1
+	case cnf.str != nil:
+		return cnf.str.staticSize()
+	case cnf.bits > 0:
+		return cnf.bits
+	}
+	return planOfVisiting(t, visiting).size
+}
+
+// isDynamic returns true if the size of t depends on the decoded value.
+func isDynamic(t reflect.Type) bool {
+	return planOf(t).size < 0
+}
+
+// SizeOf returns the size of the type t in bits.
+// It respects struct tags.
+// It returns error if the size is not fixed. e.g. slice, `bit:"len=Name"`.
+func SizeOf(t stdreflect.Type) (int, error) {
+	p := planOf(reflect.ToType(t))
+	if p.err != nil {
+		return 0, p.err
+	}
+	if p.size < 0 {
+		return 0, fmt.Errorf("size of %s is not fixed", t)
+	}
+	return p.size, nil
+}
+
+// Size returns the size of v in bits.
+// It respects struct tags. The size of variable-length field is calculated from v.
+// Nil pointer is treated as the zero value. Size(nil) returns 0.
+func Size(v interface{}) int {
+	rv := reflect.ValueOf(v)
+	if !rv.IsValid() {
+		return 0
+	}
+	if rv.Kind() == reflect.Ptr && rv.IsNil() {
+		if size := planOf(rv.Type().Elem()).size; size > 0 {
+			return size
+		}
+		return 0
+	}
+	var c int = 0
+	sizeOfValueInBits(&c, reflect.Indirect(rv))
+	return c
+}
@@ -0,0 +1,178 @@
+/*
+   Copyright 2020 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package bit
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/goccy/go-reflect"
+	"math"
+	"strconv"
+)
+
+// scaling represents "scale=", "offset=", "min=" and "max=" tags.
+// The physical value is raw * factor + offset.
+// The raw value is unsigned integer which size is "bits=N" or the size of the field.
+// It is fixed-point number if "q=" or "uq=" tag is specified.
+type scaling struct {
+	factor float64
+	offset float64
+	min    float64
+	max    float64
+}
+
+func newScaling() *scaling {
+	return &scaling{factor: 1, min: math.Inf(-1), max: math.Inf(1)}
+}
+
+// set parses the value of key.
+func (sc *scaling) set(key, val string) error {
+	f, err := strconv.ParseFloat(val, 64)
+	if err != nil || math.IsNaN(f) {
+		return fmt.Errorf("invalid tag %s=%s", key, val)
+	}
+	switch key {
+	case "scale":
+		if f == 0 || math.IsInf(f, 0) {
+			return fmt.Errorf("invalid tag %s=%s", key, val)
+		}
+		sc.factor = f
+	case "offset":
+		sc.offset = f
+	case "min":
+		sc.min = f
+	case "max":
+		sc.max = f
+	}
+	return nil
+}
+
+// check returns error if f is out of the range.
+func (sc *scaling) check(f float64) error {
+	if math.IsNaN(f) || f < sc.min || f > sc.max {
+		return fmt.Errorf("%v is out of range [%v, %v]", f, sc.min, sc.max)
+	}
+	return nil
+}
+
+// scaledSize returns the size of raw value in bits.
+func scaledSize(v reflect.Value, cnf *tagConfig) (int, error) {
+	switch v.Kind() {
+	case reflect.Float32, reflect.Float64:
+	default:
+		return 0, fmt.Errorf("scale is %w for %s", ErrUnsupportedType, v.Kind())
+	}
+	if cnf.bits > 0 {
+		return cnf.bits, nil
+	}
+	return v.Type().Bits(), nil
+}
+
+// readScaled reads raw value and fills v as physical value.
+func readScaled(s *source, order binary.ByteOrder, v reflect.Value, o *Offset, cnf *tagConfig) error {
+	var err error
+	if !v.CanSet() {
+		// skip unexported field
+		size := cnf.bits
+		if size == 0 {
+			size = planOf(v.Type()).size
+		}
+		*o, err = o.AddOffset(Offset{Bit: uint64(size)})
+		if err != nil {
+			return err
+		}
+		return errCannotInterface
+	}
+	bitSize, err := scaledSize(v, cnf)
+	if err != nil {
+		return err
+	}
+
+	if err := s.ensure(*o, uint64(bitSize)); err != nil {
+		return err
+	}
+	ret, err := getUint(s.b, *o, bitSize, order)
+	if err != nil {
+		return err
+	}
+	raw := float64(ret)
+	if cnf.fixed != nil {
+		raw = cnf.fixed.toFloat(ret)
+	}
+	f := raw*cnf.scale.factor + cnf.scale.offset
+	if err := cnf.scale.check(f); err != nil {
+		return err
+	}
+	v.SetFloat(f)
+
+	*o, err = o.AddOffset(Offset{Bit: uint64(bitSize)})
+	return err
+}
+
+// writeScaled converts physical value v to raw value and writes it to b.
+func writeScaled(v reflect.Value, order binary.ByteOrder, b []byte, o *Offset, cnf *tagConfig) error {
+	var err error
+	if !v.CanInterface() {
+		// skip unexported field
+		size := cnf.bits
+		if size == 0 {
+			size = planOf(v.Type()).size
+		}
+		*o, err = o.AddOffset(Offset{Bit: uint64(size)})
+		if err != nil {
+			return err
+		}
+		return errCannotInterface
+	}
+	bitSize, err := scaledSize(v, cnf)
+	if err != nil {
+		return err
+	}
+
+	f := v.Float()
+	if err := cnf.scale.check(f); err != nil {
+		return err
+	}
+	x := (f - cnf.scale.offset) / cnf.scale.factor
+
+	/* the raw value must be in the range of the integer */
+	signed := cnf.fixed != nil && cnf.fixed.signed
+	if cnf.fixed != nil {
+		x = math.Ldexp(x, cnf.fixed.fracBits)
+	}
+	x = math.Round(x)
+	lower, upper := 0.0, math.Ldexp(1, bitSize)
+	if signed {
+		lower, upper = -math.Ldexp(1, bitSize-1), math.Ldexp(1, bitSize-1)
+	}
+	if x < lower || x >= upper {
+		return fmt.Errorf("%v overflows %d bits", f, bitSize)
+	}
+
+	var val uint64
+	if signed {
+		val = uint64(int64(x)) & (^uint64(0) >> uint(64-bitSize))
+	} else {
+		val = uint64(x)
+	}
+	if err := putUint(b, *o, val, bitSize, order); err != nil {
+		return err
+	}
+
+	*o, err = o.AddOffset(Offset{Bit: uint64(bitSize)})
+	return err
+}
@@ -0,0 +1,113 @@
+/*
+   Copyright 2020 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package bit_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/nokute78/go-bit/v2"
+	"math"
+	"testing"
+)
+
+type engine struct {
+	Temp  float64 `bit:"bits=8,scale=1,offset=-40,min=-40,max=215"`
+	Speed float32 `bit:"bits=16,scale=0.125"`
+	Accel float64 `bit:"q=8.0,scale=0.5,min=-10,max=10"`
+}
+
+func TestReadScaled(t *testing.T) {
+	type testcase struct {
+		name   string
+		input  []byte
+		order  binary.ByteOrder
+		expect engine
+	}
+
+	cases := []testcase{
+		{"BE", []byte{0x5a, 0x01, 0x08, 0xf6}, binary.BigEndian, engine{50, 33, -5}},
+		{"LE", []byte{0x5a, 0x08, 0x01, 0x0a}, binary.LittleEndian, engine{50, 33, 5}},
+	}
+
+	for _, v := range cases {
+		var e engine
+		if err := bit.Read(bytes.NewReader(v.input), v.order, &e); err != nil {
+			t.Errorf("%s: bit.Read error:%s", v.name, err)
+			continue
+		}
+		if e != v.expect {
+			t.Errorf("%s: given=%+v expect=%+v", v.name, e, v.expect)
+		}
+
+		b := new(bytes.Buffer)
+		if err := bit.Write(b, v.order, e); err != nil {
+			t.Errorf("%s: bit.Write error:%s", v.name, err)
+			continue
+		}
+		if !bytes.Equal(b.Bytes(), v.input) {
+			t.Errorf("%s: bit.Write given=%x expect=%x", v.name, b.Bytes(), v.input)
+		}
+	}
+}
+
+func TestReadScaledOutOfRange(t *testing.T) {
+	var e engine
+	/* Temp = 255 - 40 = 215 is valid, Accel = 0x7f * 0.5 = 63.5 is out of range */
+	err := bit.Read(bytes.NewReader([]byte{0xff, 0x00, 0x00, 0x7f}), binary.BigEndian, &e)
+	if err == nil {
+		t.Errorf("Read should fail, given=%+v", e)
+	}
+}
+
+func TestWriteScaledError(t *testing.T) {
+	type testcase struct {
+		name  string
+		input engine
+	}
+
+	cases := []testcase{
+		{"less than min", engine{Temp: -41}},
+		{"greater than max", engine{Temp: 216}},
+		{"negative raw", engine{Speed: -1}},
+		{"raw overflow", engine{Speed: 8192}},
+		{"NaN", engine{Accel: math.NaN()}},
+	}
+
+	for _, v := range cases {
+		if err := bit.Write(new(bytes.Buffer), binary.BigEndian, v.input); err == nil {
+			t.Errorf("%s: Write should fail", v.name)
+		}
+	}
+}
+
+func TestScaledTagError(t *testing.T) {
+	type Int struct {
+		A uint8 `bit:"scale=0.5"`
+	}
+	var i Int
+	if err := bit.Read(bytes.NewReader([]byte{0}), binary.BigEndian, &i); err == nil {
+		t.Errorf("Read should fail for uint8 field")
+	}
+
+	type Zero struct {
+		A float32 `bit:"scale=0"`
+	}
+	var z Zero
+	if err := bit.Read(bytes.NewReader(make([]byte, 4)), binary.BigEndian, &z); err == nil {
+		t.Errorf("Read should fail for scale=0")
+	}
+}
@@ -0,0 +1,360 @@
+/*
+   Copyright 2020 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package bit
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"gopkg.in/yaml.v2"
+)
+
+// Schema describes a binary format without Go types.
+// It is built programmatically or loaded from JSON by ParseSchema or YAML by ParseSchemaYAML.
+//   {
+//     "name": "ipv4",
+//     "endian": "BE",
+//     "fields": [
+//       {"name": "Version", "bits": 4},
+//       {"name": "IHL", "bits": 4},
+//       {"name": "Options", "count": 2, "fields": [{"name": "Type", "bits": 8}, {"name": "Len", "bits": 8}]}
+//     ]
+//   }
+type Schema struct {
+	Name   string        `json:"name,omitempty" yaml:"name,omitempty"`
+	Endian string        `json:"endian,omitempty" yaml:"endian,omitempty"` /* "BE" or "LE". default is "BE" */
+	Fields []SchemaField `json:"fields" yaml:"fields"`
+}
+
+// SchemaField is a field of Schema.
+// The field is an integer of Bits bits, or a struct which has Fields.
+// It is an array if Count or Len is set.
+type SchemaField struct {
+	Name   string        `json:"name" yaml:"name"`
+	Bits   int           `json:"bits,omitempty" yaml:"bits,omitempty"`     /* the size of the integer. 1-64 */
+	Signed bool          `json:"signed,omitempty" yaml:"signed,omitempty"` /* the integer is sign extended */
+	Endian string        `json:"endian,omitempty" yaml:"endian,omitempty"` /* "BE" or "LE". default is the endian of the parent */
+	Count  int           `json:"count,omitempty" yaml:"count,omitempty"`   /* the number of the elements */
+	Len    string        `json:"len,omitempty" yaml:"len,omitempty"`       /* the number of the elements is the value of the preceding field */
+	Fields []SchemaField `json:"fields,omitempty" yaml:"fields,omitempty"` /* the fields of the nested struct */
+}
+
+// Value is a decoded value of Schema.
+// An integer has Raw. A struct and an array have Fields in order.
+// The elements of the array are named "[0]", "[1]" and so on.
+type Value struct {
+	Name   string
+	Offset Offset
+	Size   int    /* the size in bits */
+	Raw    uint64 /* the value of the integer. signed integer is sign extended. */
+	Fields []Value
+}
+
+// Uint returns the value of the integer.
+func (v *Value) Uint() uint64 {
+	return v.Raw
+}
+
+// Int returns the value of the signed integer.
+func (v *Value) Int() int64 {
+	return int64(v.Raw)
+}
+
+// Lookup returns the value of the path. e.g. "Hdr.Options[2].Len"
+// It returns nil if the path is not found.
+func (v *Value) Lookup(path string) *Value {
+	for _, name := range splitPath(path) {
+		v = v.child(name)
+	}
+	return v
+}
+
+// child returns the field or the element of v. It returns nil if v is nil.
+func (v *Value) child(name string) *Value {
+	if v == nil {
+		return nil
+	}
+	for i := range v.Fields {
+		if v.Fields[i].Name == name {
+			return &v.Fields[i]
+		}
+	}
+	return nil
+}
+
+// ParseSchema parses the JSON encoded schema.
+func ParseSchema(data []byte) (*Schema, error) {
+	var s Schema
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, err
+	}
+	if err := s.validate(); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// ParseSchemaYAML parses the YAML encoded schema. The keys are same as JSON.
+//   name: ipv4
+//   endian: BE
+//   fields:
+//     - {name: Version, bits: 4}
+//     - {name: IHL, bits: 4}
+func ParseSchemaYAML(data []byte) (*Schema, error) {
+	var s Schema
+	if err := yaml.Unmarshal(data, &s); err != nil {
+		return nil, err
+	}
+	if err := s.validate(); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (s *Schema) validate() error {
+	if _, err := schemaOrder(s.Endian, binary.BigEndian); err != nil {
+		return err
+	}
+	return validateFields(s.Fields)
+}
+
+func validateFields(fields []SchemaField) error {
+	for i, f := range fields {
+		if f.Name == "" {
+			return fmt.Errorf("schema: field #%d has no name", i)
+		}
+		if _, err := schemaOrder(f.Endian, binary.BigEndian); err != nil {
+			return fmt.Errorf("schema: %s: %w", f.Name, err)
+		}
+		switch {
+		case f.Bits > 0 && len(f.Fields) > 0:
+			return fmt.Errorf("schema: %s: bits and fields cannot be used together", f.Name)
+		case len(f.Fields) > 0:
+			if f.Signed {
+				return fmt.Errorf("schema: %s: signed struct", f.Name)
+			}
+			if err := validateFields(f.Fields); err != nil {
+				return err
+			}
+		case f.Bits < 1 || f.Bits > 64:
+			return fmt.Errorf("schema: %s: bits=%d is out of range 1-64", f.Name, f.Bits)
+		}
+		if f.Count < 0 {
+			return fmt.Errorf("schema: %s: negative count", f.Name)
+		} else if f.Count > 0 && f.Len != "" {
+			return fmt.Errorf("schema: %s: count and len cannot be used together", f.Name)
+		} else if f.Len != "" && !isLengthField(fields[:i], f.Len) {
+			return fmt.Errorf("schema: %s: len=%s must be a preceding integer field", f.Name, f.Len)
+		}
+	}
+	return nil
+}
+
+// isLengthField returns true if fields has the integer field name.
+func isLengthField(fields []SchemaField, name string) bool {
+	for _, f := range fields {
+		if f.Name == name {
+			return !f.isArray() && len(f.Fields) == 0 && !f.Signed
+		}
+	}
+	return false
+}
+
+func (f *SchemaField) isArray() bool {
+	return f.Count > 0 || f.Len != ""
+}
+
+// elem returns the field of the i-th element of the array f.
+func (f *SchemaField) elem(i int) *SchemaField {
+	e := *f
+	e.Name = fmt.Sprintf("[%d]", i)
+	e.Count, e.Len = 0, ""
+	return &e
+}
+
+func schemaOrder(endian string, def binary.ByteOrder) (binary.ByteOrder, error) {
+	switch endian {
+	case "":
+		return def, nil
+	case "BE":
+		return binary.BigEndian, nil
+	case "LE":
+		return binary.LittleEndian, nil
+	}
+	return nil, fmt.Errorf("invalid endian %q", endian)
+}
+
+// Decode decodes buf from the beginning according to s.
+// It returns the root value whose Fields are the values of s.Fields.
+func (s *Schema) Decode(buf []byte) (*Value, error) {
+	if err := s.validate(); err != nil {
+		return nil, err
+	}
+	order, _ := schemaOrder(s.Endian, binary.BigEndian)
+	src := &source{b: buf}
+	var o Offset
+	fields, err := decodeFields(src, order, s.Fields, &o)
+	if err != nil {
+		return nil, err
+	}
+	return &Value{Name: s.Name, Size: int(o.Bits()), Fields: fields}, nil
+}
+
+func decodeFields(s *source, order binary.ByteOrder, fields []SchemaField, o *Offset) ([]Value, error) {
+	ret := make([]Value, 0, len(fields))
+	for i := range fields {
+		start := *o
+		v, err := decodeField(s, order, &fields[i], ret, o)
+		if err != nil {
+			return nil, decodeError(err, fields[i].Name, start, fields[i].Bits)
+		}
+		ret = append(ret, v)
+	}
+	return ret, nil
+}
+
+// decodeField decodes f. decoded is the preceding values of the struct.
+func decodeField(s *source, order binary.ByteOrder, f *SchemaField, decoded []Value, o *Offset) (Value, error) {
+	order, _ = schemaOrder(f.Endian, order)
+	ret := Value{Name: f.Name, Offset: *o}
+	var err error
+
+	switch {
+	case f.isArray():
+		n := f.Count
+		if f.Len != "" {
+			n = int((&Value{Fields: decoded}).child(f.Len).Uint())
+		}
+		/* n is not trusted. the array grows until buf runs out. */
+		ret.Fields = []Value{}
+		for i := 0; i < n; i++ {
+			start := *o
+			e, err := decodeField(s, order, f.elem(i), nil, o)
+			if err != nil {
+				return ret, decodeError(err, fmt.Sprintf("[%d]", i), start, f.Bits)
+			}
+			ret.Fields = append(ret.Fields, e)
+		}
+	case len(f.Fields) > 0:
+		ret.Fields, err = decodeFields(s, order, f.Fields, o)
+		if err != nil {
+			return ret, err
+		}
+	default:
+		ret.Raw, err = readUint(s, o, f.Bits, order)
+		if err != nil {
+			return ret, err
+		}
+		if f.Signed {
+			ret.Raw = uint64(signExtend(ret.Raw, f.Bits))
+		}
+	}
+	ret.Size = int(o.Bits() - ret.Offset.Bits())
+	return ret, nil
+}
+
+// Encode encodes v according to s. v is the root value returned by Decode.
+// The missing field is encoded as zero.
+// The length field of `len` array is replaced by the number of the elements.
+// The last byte is padded with 0 if the size is not multiple of 8.
+func (s *Schema) Encode(v *Value) ([]byte, error) {
+	if err := s.validate(); err != nil {
+		return nil, err
+	}
+	order, _ := schemaOrder(s.Endian, binary.BigEndian)
+	var e schemaEncoder
+	if err := e.encodeFields(order, s.Fields, v); err != nil {
+		return nil, err
+	}
+	return e.b, nil
+}
+
+// schemaEncoder encodes Value into b which grows on demand.
+type schemaEncoder struct {
+	b []byte
+	o Offset
+}
+
+func (e *schemaEncoder) encodeFields(order binary.ByteOrder, fields []SchemaField, v *Value) error {
+	/* the length of `len` array */
+	lengths := map[string]int{}
+	for _, f := range fields {
+		if f.Len != "" {
+			if a := v.child(f.Name); a != nil {
+				lengths[f.Len] = len(a.Fields)
+			} else {
+				lengths[f.Len] = 0
+			}
+		}
+	}
+
+	for i := range fields {
+		f := &fields[i]
+		start := e.o
+		fv := v.child(f.Name)
+		if n, ok := lengths[f.Name]; ok {
+			fv = &Value{Name: f.Name, Raw: uint64(n)}
+		}
+		if err := e.encodeField(order, f, fv); err != nil {
+			return encodeError(err, f.Name, start, f.Bits)
+		}
+	}
+	return nil
+}
+
+// encodeField encodes v as f. v may be nil.
+func (e *schemaEncoder) encodeField(order binary.ByteOrder, f *SchemaField, v *Value) error {
+	order, _ = schemaOrder(f.Endian, order)
+
+	switch {
+	case f.isArray():
+		n := f.Count
+		if f.Len != "" && v != nil {
+			n = len(v.Fields)
+		} else if v != nil && len(v.Fields) > n {
+			return fmt.Errorf("%d elements exceed count=%d", len(v.Fields), n)
+		}
+		for i := 0; i < n; i++ {
+			start := e.o
+			var ev *Value
+			if v != nil && i < len(v.Fields) {
+				ev = &v.Fields[i]
+			}
+			if err := e.encodeField(order, f.elem(i), ev); err != nil {
+				return encodeError(err, fmt.Sprintf("[%d]", i), start, f.Bits)
+			}
+		}
+		return nil
+	case len(f.Fields) > 0:
+		return e.encodeFields(order, f.Fields, v)
+	}
+
+	var val uint64
+	if v != nil {
+		val = v.Raw
+	}
+	if f.Signed && f.Bits < 64 {
+		if signExtend(val&(1<<uint(f.Bits)-1), f.Bits) != int64(val) {
+			return fmt.Errorf("%d overflows %d bits", int64(val), f.Bits)
+		}
+		val &= 1<<uint(f.Bits) - 1
+	}
+	if n := sizeOfBits(int(e.o.Bits()) + f.Bits); n > len(e.b) {
+		e.b = append(e.b, make([]byte, n-len(e.b))...)
+	}
+	return writeUint(e.b, &e.o, val, f.Bits, order)
+}
@@ -0,0 +1,242 @@
+/*
+   Copyright 2020 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package bit_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"github.com/nokute78/go-bit/v2"
+	"reflect"
+	"testing"
+)
+
+const testSchema = `{
+	"name": "packet",
+	"fields": [
+		{"name": "Version", "bits": 4},
+		{"name": "Delta", "bits": 4, "signed": true},
+		{"name": "Seq", "bits": 16, "endian": "LE"},
+		{"name": "Flags", "count": 4, "bits": 1},
+		{"name": "_", "bits": 4},
+		{"name": "N", "bits": 8},
+		{"name": "Options", "len": "N", "fields": [
+			{"name": "Type", "bits": 8},
+			{"name": "Len", "bits": 8}
+		]}
+	]
+}`
+
+type schemaPacket struct {
+	Version uint8      `bit:"bits=4"`
+	Delta   int8       `bit:"bits=4"`
+	Seq     uint16     `bit:"LE"`
+	Flags   [4]bit.Bit `bit:"msb"`
+	_       uint8      `bit:"bits=4"`
+	N       uint8
+	Options []struct {
+		Type uint8
+		Len  uint8
+	} `bit:"len=N"`
+}
+
+func TestSchemaDecode(t *testing.T) {
+	s, err := bit.ParseSchema([]byte(testSchema))
+	if err != nil {
+		t.Fatalf("ParseSchema error:%s", err)
+	}
+	input := []byte{0x4e, 0x34, 0x12, 0xa0, 0x02, 0x01, 0x02, 0x03, 0x04}
+
+	v, err := s.Decode(input)
+	if err != nil {
+		t.Fatalf("Decode error:%s", err)
+	}
+	if v.Name != "packet" || v.Size != len(input)*8 || len(v.Fields) != 7 {
+		t.Errorf("root given=%+v", v)
+	}
+
+	/* same as the struct */
+	var p schemaPacket
+	if _, err := bit.Unmarshal(input, bit.Offset{}, binary.BigEndian, &p); err != nil {
+		t.Fatalf("Unmarshal error:%s", err)
+	}
+	if v.Lookup("Version").Uint() != uint64(p.Version) || v.Lookup("Delta").Int() != int64(p.Delta) ||
+		v.Lookup("Seq").Uint() != uint64(p.Seq) || v.Lookup("N").Uint() != uint64(p.N) {
+		t.Errorf("given=%+v expect=%+v", v, p)
+	}
+	for i, f := range p.Flags {
+		if b := v.Lookup("Flags").Fields[i].Uint(); b != 0 != bool(f) {
+			t.Errorf("Flags[%d] given=%d expect=%v", i, b, f)
+		}
+	}
+	if n := len(v.Lookup("Options").Fields); n != len(p.Options) {
+		t.Fatalf("len(Options) given=%d expect=%d", n, len(p.Options))
+	}
+	for i, o := range p.Options {
+		e := v.Lookup("Options").Fields[i]
+		if e.Lookup("Type").Uint() != uint64(o.Type) || e.Lookup("Len").Uint() != uint64(o.Len) {
+			t.Errorf("Options[%d] given=%+v expect=%+v", i, e, o)
+		}
+	}
+
+	opt := v.Lookup("Options[1].Len")
+	if opt == nil {
+		t.Fatalf("Options[1].Len is not found")
+	}
+	if opt.Offset != (bit.Offset{Byte: 8}) || opt.Size != 8 || opt.Uint() != 4 {
+		t.Errorf("Options[1].Len given=%+v", opt)
+	}
+	if v.Lookup("Options[2]") != nil || v.Lookup("Nothing.Len") != nil {
+		t.Errorf("Lookup should return nil")
+	}
+}
+
+const testSchemaYAML = `
+name: packet
+fields:
+  - {name: Version, bits: 4}
+  - {name: Delta, bits: 4, signed: true}
+  - {name: Seq, bits: 16, endian: LE}
+  - {name: Flags, count: 4, bits: 1}
+  - {name: _, bits: 4}
+  - {name: N, bits: 8}
+  - name: Options
+    len: N
+    fields:
+      - {name: Type, bits: 8}
+      - {name: Len, bits: 8}
+`
+
+func TestParseSchemaYAML(t *testing.T) {
+	y, err := bit.ParseSchemaYAML([]byte(testSchemaYAML))
+	if err != nil {
+		t.Fatalf("ParseSchemaYAML error:%s", err)
+	}
+	j, err := bit.ParseSchema([]byte(testSchema))
+	if err != nil {
+		t.Fatalf("ParseSchema error:%s", err)
+	}
+	if !reflect.DeepEqual(y, j) {
+		t.Errorf("mismatch\n yaml=%+v\n json=%+v", y, j)
+	}
+
+	invalid := []string{
+		"fields: [{bits: 8}]",
+		"fields: [{name: A, bits: 65}]",
+		"fields: [",
+	}
+	for _, v := range invalid {
+		if _, err := bit.ParseSchemaYAML([]byte(v)); err == nil {
+			t.Errorf("ParseSchemaYAML should fail. %s", v)
+		}
+	}
+}
+
+func TestSchemaEncode(t *testing.T) {
+	s, err := bit.ParseSchema([]byte(testSchema))
+	if err != nil {
+		t.Fatalf("ParseSchema error:%s", err)
+	}
+	input := []byte{0x4e, 0x34, 0x12, 0xa0, 0x02, 0x01, 0x02, 0x03, 0x04}
+	v, err := s.Decode(input)
+	if err != nil {
+		t.Fatalf("Decode error:%s", err)
+	}
+
+	b, err := s.Encode(v)
+	if err != nil {
+		t.Fatalf("Encode error:%s", err)
+	}
+	if !bytes.Equal(b, input) {
+		t.Errorf("round trip mismatch\n given =%x\n expect=%x", b, input)
+	}
+
+	/* N is updated by the length of Options */
+	opts := v.Lookup("Options")
+	opts.Fields = opts.Fields[:1]
+	delta := int64(-8)
+	v.Lookup("Delta").Raw = uint64(delta)
+	b, err = s.Encode(v)
+	if err != nil {
+		t.Fatalf("Encode error:%s", err)
+	}
+	expect := []byte{0x48, 0x34, 0x12, 0xa0, 0x01, 0x01, 0x02}
+	if !bytes.Equal(b, expect) {
+		t.Errorf("mismatch\n given =%x\n expect=%x", b, expect)
+	}
+}
+
+func TestSchemaBuild(t *testing.T) {
+	s := &bit.Schema{
+		Endian: "LE",
+		Fields: []bit.SchemaField{
+			{Name: "A", Bits: 16},
+			{Name: "B", Bits: 8, Endian: "BE"},
+			{Name: "C", Count: 2, Fields: []bit.SchemaField{{Name: "X", Bits: 4}}},
+		},
+	}
+	/* missing field is zero */
+	v := &bit.Value{Fields: []bit.Value{
+		{Name: "A", Raw: 0xabc},
+		{Name: "B", Raw: 0x12},
+		{Name: "C", Fields: []bit.Value{{Fields: []bit.Value{{Name: "X", Raw: 0x5}}}}},
+	}}
+	b, err := s.Encode(v)
+	if err != nil {
+		t.Fatalf("Encode error:%s", err)
+	}
+	expect := []byte{0xbc, 0x0a, 0x12, 0x05}
+	if !bytes.Equal(b, expect) {
+		t.Errorf("mismatch\n given =%x\n expect=%x", b, expect)
+	}
+
+	v.Lookup("A").Raw = 0x10000
+	if _, err := s.Encode(v); err == nil {
+		t.Errorf("Encode should fail for overflow")
+	}
+}
+
+func TestSchemaError(t *testing.T) {
+	invalid := []string{
+		`{"fields": [{"bits": 8}]}`,
+		`{"fields": [{"name": "A", "bits": 65}]}`,
+		`{"fields": [{"name": "A"}]}`,
+		`{"fields": [{"name": "A", "bits": 8, "fields": [{"name": "B", "bits": 8}]}]}`,
+		`{"fields": [{"name": "A", "bits": 8, "endian": "big"}]}`,
+		`{"fields": [{"name": "A", "bits": 8, "len": "N"}, {"name": "N", "bits": 8}]}`,
+		`{"fields": [{"name": "N", "bits": 8}, {"name": "A", "bits": 8, "len": "N", "count": 2}]}`,
+		`{"fields": [`,
+	}
+	for _, v := range invalid {
+		if _, err := bit.ParseSchema([]byte(v)); err == nil {
+			t.Errorf("ParseSchema should fail. %s", v)
+		}
+	}
+
+	s, err := bit.ParseSchema([]byte(testSchema))
+	if err != nil {
+		t.Fatalf("ParseSchema error:%s", err)
+	}
+	_, err = s.Decode([]byte{0x4e, 0x34, 0x12, 0xa0, 0x02, 0x01, 0x02, 0x03})
+	var derr *bit.DecodeError
+	if !errors.As(err, &derr) || derr.Path != "Options[1].Len" || derr.Offset != (bit.Offset{Byte: 8}) {
+		t.Errorf("given=%v", err)
+	}
+	if !errors.Is(err, bit.ErrShortBuffer) {
+		t.Errorf("errors.Is(err, ErrShortBuffer) is false. err=%v", err)
+	}
+}
@@ -0,0 +1,200 @@
+/*
+   Copyright 2020 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package bit
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"github.com/goccy/go-reflect"
+	"strconv"
+	"strings"
+)
+
+const (
+	strFixed      = iota /* "str=N"  */
+	strTerminated        /* "cstr"   */
+	strPrefixed          /* "pstr=N" */
+)
+
+// stringFormat represents "str=N", "cstr" and "pstr=N" tags.
+//   "str=N"  : the string has N characters. Trailing NULs are trimmed.
+//   "cstr"   : the string is terminated by NUL.
+//   "pstr=N" : the string is prefixed by N bits length.
+//   "charset=ascii7": the character is 7 bits. e.g. packed SMS PDU.
+type stringFormat struct {
+	kind     int
+	n        int /* the number of characters for "str=N", the size of length for "pstr=N" */
+	charBits int
+}
+
+func parseStringFormat(v string) (*stringFormat, error) {
+	ret := &stringFormat{charBits: 8}
+	switch {
+	case v == "cstr":
+		ret.kind = strTerminated
+		return ret, nil
+	case strings.HasPrefix(v, "str="):
+		ret.kind = strFixed
+	case strings.HasPrefix(v, "pstr="):
+		ret.kind = strPrefixed
+	}
+	n, err := strconv.Atoi(v[strings.Index(v, "=")+1:])
+	if err != nil || n <= 0 || (ret.kind == strPrefixed && n > 32) {
+		return nil, fmt.Errorf("invalid tag %q", v)
+	}
+	ret.n = n
+	return ret, nil
+}
+
+// setCharset sets the size of a character.
+func (sf *stringFormat) setCharset(charset string) error {
+	switch charset {
+	case "ascii7":
+		sf.charBits = 7
+	case "ascii", "byte":
+		sf.charBits = 8
+	default:
+		return fmt.Errorf("charset %q is Not Supported", charset)
+	}
+	return nil
+}
+
+func (sf *stringFormat) String() string {
+	switch sf.kind {
+	case strTerminated:
+		return "cstr"
+	case strPrefixed:
+		return fmt.Sprintf("pstr=%d", sf.n)
+	}
+	return fmt.Sprintf("str=%d", sf.n)
+}
+
+// staticSize returns the size in bits. It returns -1 if the size depends on the value.
+func (sf *stringFormat) staticSize() int {
+	if sf.kind == strFixed {
+		return sf.n * sf.charBits
+	}
+	return -1
+}
+
+// size returns the size of the string v in bits.
+func (sf *stringFormat) size(v reflect.Value) int {
+	switch sf.kind {
+	case strTerminated:
+		return (v.Len() + 1) * sf.charBits
+	case strPrefixed:
+		return sf.n + v.Len()*sf.charBits
+	}
+	return sf.staticSize()
+}
+
+// readString reads the string and fills v.
+func readString(s *source, order binary.ByteOrder, v reflect.Value, o *Offset, sf *stringFormat) error {
+	if v.Kind() != reflect.String {
+		return fmt.Errorf("%s is %w for %s", sf, ErrUnsupportedType, v.Kind())
+	}
+
+	n := sf.n
+	if sf.kind == strPrefixed {
+		l, err := readUint(s, o, sf.n, order)
+		if err != nil {
+			return err
+		}
+		if l > uint64(maxInt) {
+			return fmt.Errorf("%s: length %d is too large", sf, l)
+		}
+		n = int(l)
+	}
+
+	/* the length of pstr comes from the input. don't allocate more than the input. */
+	capacity := n
+	if rest := s.rest(*o) / uint64(sf.charBits); uint64(capacity) > rest {
+		capacity = int(rest)
+	}
+	buf := make([]byte, 0, capacity)
+	for i := 0; sf.kind == strTerminated || i < n; i++ {
+		c, err := readUint(s, o, sf.charBits, order)
+		if err != nil {
+			return err
+		}
+		if c == 0 && sf.kind == strTerminated {
+			break
+		}
+		buf = append(buf, byte(c))
+	}
+	if sf.kind == strFixed {
+		buf = bytes.TrimRight(buf, "\x00")
+	}
+
+	if !v.CanSet() {
+		return errCannotInterface
+	}
+	v.SetString(string(buf))
+	return nil
+}
+
+// writeString writes the string v to b.
+func writeString(v reflect.Value, order binary.ByteOrder, b []byte, o *Offset, sf *stringFormat) error {
+	var err error
+	if v.Kind() != reflect.String {
+		return fmt.Errorf("%s is %w for %s", sf, ErrUnsupportedType, v.Kind())
+	}
+	if !v.CanInterface() {
+		// skip unexported field
+		*o, err = o.AddOffset(Offset{Bit: uint64(sf.size(v))})
+		if err != nil {
+			return err
+		}
+		return errCannotInterface
+	}
+
+	str := v.String()
+	for i := 0; i < len(str); i++ {
+		if sf.charBits < 8 && str[i]>>uint(sf.charBits) != 0 {
+			return fmt.Errorf("%q cannot be encoded as %d bits character", str[i], sf.charBits)
+		}
+		if str[i] == 0 && sf.kind == strTerminated {
+			return fmt.Errorf("%s: the string contains NUL", sf)
+		}
+	}
+
+	switch sf.kind {
+	case strFixed:
+		if len(str) > sf.n {
+			return fmt.Errorf("%s: the length %d exceeds %d", sf, len(str), sf.n)
+		}
+		/* padded with NUL */
+		str += strings.Repeat("\x00", sf.n-len(str))
+	case strTerminated:
+		str += "\x00"
+	case strPrefixed:
+		if uint64(len(str))>>uint(sf.n) != 0 {
+			return fmt.Errorf("%s: the length %d overflows", sf, len(str))
+		}
+		if err := writeUint(b, o, uint64(len(str)), sf.n, order); err != nil {
+			return err
+		}
+	}
+
+	for i := 0; i < len(str); i++ {
+		if err := writeUint(b, o, uint64(str[i]), sf.charBits, order); err != nil {
+			return err
+		}
+	}
+	return nil
+}
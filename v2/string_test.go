@@ -0,0 +1,172 @@
+/*
+   Copyright 2020 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package bit_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/nokute78/go-bit/v2"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func TestReadString(t *testing.T) {
+	type S struct {
+		Fixed   string `bit:"str=6"`
+		CStr    string `bit:"cstr"`
+		PStr    string `bit:"pstr=8"`
+		Empty   string `bit:"cstr"`
+		Trailer uint8
+	}
+
+	input := []byte{'e', 't', 'h', '0', 0, 0, 'a', 'b', 0, 3, 'x', 'y', 'z', 0, 0xff, 0xaa}
+	expect := S{"eth0", "ab", "xyz", "", 0xff}
+
+	var s S
+	br := bytes.NewReader(input)
+	if err := bit.Read(br, binary.BigEndian, &s); err != nil {
+		t.Fatalf("bit.Read error:%s", err)
+	}
+	if s != expect {
+		t.Errorf("given=%+v expect=%+v", s, expect)
+	}
+	if br.Len() != 1 {
+		t.Errorf("remaining: given=%d expect=1", br.Len())
+	}
+
+	if size := bit.Size(s); size != 15*8 {
+		t.Errorf("Size: given=%d expect=%d", size, 15*8)
+	}
+
+	b := new(bytes.Buffer)
+	if err := bit.Write(b, binary.BigEndian, s); err != nil {
+		t.Fatalf("bit.Write error:%s", err)
+	}
+	if !bytes.Equal(b.Bytes(), input[:15]) {
+		t.Errorf("bit.Write: given=%x expect=%x", b.Bytes(), input[:15])
+	}
+}
+
+func TestStringASCII7(t *testing.T) {
+	type SMS struct {
+		Text string `bit:"str=10,charset=ascii7"`
+	}
+	/* "hellohello" in GSM 7 bit default alphabet */
+	input := []byte{0xe8, 0x32, 0x9b, 0xfd, 0x46, 0x97, 0xd9, 0xec, 0x37}
+
+	var s SMS
+	if _, err := bit.Unmarshal(input, bit.Offset{}, binary.LittleEndian, &s); err != nil {
+		t.Fatalf("bit.Unmarshal error:%s", err)
+	}
+	if s.Text != "hellohello" {
+		t.Errorf("given=%q", s.Text)
+	}
+
+	if size, err := bit.SizeOf(reflect.TypeOf(s)); err != nil || size != 70 {
+		t.Errorf("SizeOf: given=%d err=%v", size, err)
+	}
+
+	b, _, err := bit.Marshal(s, binary.LittleEndian)
+	if err != nil {
+		t.Fatalf("bit.Marshal error:%s", err)
+	}
+	if !bytes.Equal(b, input) {
+		t.Errorf("bit.Marshal: given=%x expect=%x", b, input)
+	}
+}
+
+func TestWriteStringError(t *testing.T) {
+	type Fixed struct {
+		S string `bit:"str=2"`
+	}
+	type CStr struct {
+		S string `bit:"cstr"`
+	}
+	type PStr struct {
+		S string `bit:"pstr=2"`
+	}
+	type ASCII7 struct {
+		S string `bit:"cstr,charset=ascii7"`
+	}
+
+	type testcase struct {
+		name  string
+		input interface{}
+	}
+	cases := []testcase{
+		{"too long", Fixed{"abc"}},
+		{"NUL", CStr{"a\x00b"}},
+		{"length overflow", PStr{"abcd"}},
+		{"not ascii", ASCII7{"\xe9"}},
+	}
+
+	for _, v := range cases {
+		if err := bit.Write(new(bytes.Buffer), binary.BigEndian, v.input); err == nil {
+			t.Errorf("%s: Write should fail", v.name)
+		}
+	}
+}
+
+func TestReadStringLongPrefix(t *testing.T) {
+	type S struct {
+		S string `bit:"pstr=32"`
+	}
+	input := []byte{0xff, 0xff, 0xff, 0xff, 0x61, 0x62}
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	var s S
+	if _, err := bit.Unmarshal(input, bit.Offset{}, binary.BigEndian, &s); err == nil {
+		t.Errorf("Unmarshal should fail")
+	}
+	if err := bit.Read(bytes.NewReader(input), binary.BigEndian, &s); err == nil {
+		t.Errorf("Read should fail")
+	}
+	runtime.ReadMemStats(&after)
+	if alloc := after.TotalAlloc - before.TotalAlloc; alloc > 1<<20 {
+		t.Errorf("allocated %d bytes for 6 bytes input", alloc)
+	}
+}
+
+func TestStringTagError(t *testing.T) {
+	type Int struct {
+		A uint8 `bit:"cstr"`
+	}
+	type Charset struct {
+		A string `bit:"charset=ascii7"`
+	}
+	type Unknown struct {
+		A string `bit:"str=4,charset=ebcdic"`
+	}
+
+	type testcase struct {
+		name  string
+		input interface{}
+	}
+	cases := []testcase{
+		{"not string", &Int{}},
+		{"no str tag", &Charset{}},
+		{"unknown charset", &Unknown{}},
+	}
+
+	for _, v := range cases {
+		if err := bit.Read(bytes.NewReader(make([]byte, 8)), binary.BigEndian, v.input); err == nil {
+			t.Errorf("%s: Read should fail", v.name)
+		}
+	}
+}
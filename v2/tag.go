@@ -18,7 +18,9 @@ package bit
 
 import (
 	"encoding/binary"
+	"fmt"
 	"github.com/goccy/go-reflect"
+	"strconv"
 	"strings"
 )
 
@@ -31,34 +33,189 @@ const (
 //   "skip": ignore but offset will be updated
 //   "BE"  : the field is treated as big endian
 //   "LE"  : the field is treated as little endian
+//   "bits=N": the field is treated as N bits integer
+//   "len=Name": the slice has elements which number is the value of field Name
+//   "size=Name": the slice has bytes which number is the value of field Name
+//   "if=Cond": the field exists only if Cond is true. See condition.
+//   "switch=Name": the interface field is decoded as the variant selected by field Name
+//   "q=M.N": the float field is treated as signed fixed-point number. See fixedPoint.
+//   "uq=M.N": the float field is treated as unsigned fixed-point number.
+//   "scale=F", "offset=F", "min=F", "max=F": the float field is physical value. See scaling.
+//   "str=N", "cstr", "pstr=N", "charset=Name": the string field. See stringFormat.
+//   "align=N": the field starts at the next multiple of N bits from the start of the struct
+//   "pad=N": N reserved bits precede the field
+//   "at=N", "at=N.M": the field starts at N bits (N bytes and M bits) from the start of the struct. See parseAt.
+//   "const=V", "mbz": the field must be V or zero. See constraint.
+//   "checksum=Name", "Name=From..To": the field is the checksum. See checksumConfig.
+//   "msb", "lsb": bits of the field are read MSB first or LSB first regardless of byte order. See BitOrder.
+//   "reverse": the bits of the field are reversed
 type tagConfig struct {
-	ignore bool
-	skip   bool
-	endian binary.ByteOrder
+	ignore      bool
+	skip        bool
+	endian      binary.ByteOrder
+	bits        int
+	lenField    string
+	sizeField   string
+	cond        *condition
+	switchField string
+	fixed       *fixedPoint
+	scale       *scaling
+	str         *stringFormat
+	align       int
+	pad         int
+	at          *Offset
+	constraint  *constraint
+	checksum    *checksumConfig
+	bitOrder    *BitOrder
+	reverse     bool
 }
 
-func parseStructTag(t reflect.StructTag) *tagConfig {
+// order returns the byte order of the field. def is the byte order of the struct.
+// The bit order given by msb/lsb is kept with the byte order. See bitOrdered.
+func (cnf *tagConfig) order(def binary.ByteOrder) binary.ByteOrder {
+	if cnf == nil {
+		return def
+	}
+	ret := def
+	if cnf.endian != nil {
+		/* the bit order inherited from the struct is kept */
+		ret = cnf.endian
+		if bo, ok := def.(bitOrdered); ok {
+			ret = withBitOrder(ret, bo.bo)
+		}
+	}
+	if cnf.bitOrder != nil {
+		ret = withBitOrder(ret, *cnf.bitOrder)
+	}
+	return ret
+}
+
+func parseStructTag(t reflect.StructTag) (*tagConfig, error) {
 	s, ok := t.Lookup(tagKeyName)
 	if !ok {
-		return nil
+		return nil, nil
 	}
 	ret := &tagConfig{}
 
+	var charset string
 	strs := strings.Split(s, ",")
 	for _, v := range strs {
-		switch v {
-		case "-":
+		switch {
+		case v == "-":
 			ret.ignore = true
-			return ret
-		case "skip":
+			return ret, nil
+		case v == "skip":
 			ret.skip = true
-			return ret
-		case "BE":
+		case v == "BE":
 			ret.endian = binary.BigEndian
-		case "LE":
+		case v == "LE":
 			ret.endian = binary.LittleEndian
+		case strings.HasPrefix(v, "bits="):
+			n, err := strconv.Atoi(strings.TrimPrefix(v, "bits="))
+			if err != nil || n <= 0 || n > 64 {
+				return nil, fmt.Errorf("invalid tag %q", v)
+			}
+			ret.bits = n
+		case strings.HasPrefix(v, "len="):
+			ret.lenField = strings.TrimPrefix(v, "len=")
+		case strings.HasPrefix(v, "size="):
+			ret.sizeField = strings.TrimPrefix(v, "size=")
+		case strings.HasPrefix(v, "if="):
+			c, err := parseCondition(strings.TrimPrefix(v, "if="))
+			if err != nil {
+				return nil, err
+			}
+			ret.cond = c
+		case strings.HasPrefix(v, "switch="):
+			ret.switchField = strings.TrimPrefix(v, "switch=")
+		case strings.HasPrefix(v, "q="), strings.HasPrefix(v, "uq="):
+			q, err := parseFixedPoint(v[strings.Index(v, "=")+1:], v[0] == 'q')
+			if err != nil {
+				return nil, err
+			}
+			ret.fixed = q
+		case strings.HasPrefix(v, "scale="), strings.HasPrefix(v, "offset="),
+			strings.HasPrefix(v, "min="), strings.HasPrefix(v, "max="):
+			if ret.scale == nil {
+				ret.scale = newScaling()
+			}
+			kv := strings.SplitN(v, "=", 2)
+			if err := ret.scale.set(kv[0], kv[1]); err != nil {
+				return nil, err
+			}
+		case v == "cstr", strings.HasPrefix(v, "str="), strings.HasPrefix(v, "pstr="):
+			sf, err := parseStringFormat(v)
+			if err != nil {
+				return nil, err
+			}
+			ret.str = sf
+		case strings.HasPrefix(v, "align="), strings.HasPrefix(v, "pad="):
+			kv := strings.SplitN(v, "=", 2)
+			n, err := strconv.Atoi(kv[1])
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("invalid tag %q", v)
+			}
+			if kv[0] == "align" {
+				ret.align = n
+			} else {
+				ret.pad = n
+			}
+		case strings.HasPrefix(v, "at="):
+			at, err := parseAt(strings.TrimPrefix(v, "at="))
+			if err != nil {
+				return nil, err
+			}
+			ret.at = at
+		case strings.HasPrefix(v, "const="):
+			c, err := parseConst(strings.TrimPrefix(v, "const="))
+			if err != nil {
+				return nil, err
+			}
+			ret.constraint = c
+		case v == "mbz":
+			ret.constraint = &constraint{}
+		case strings.HasPrefix(v, "charset="):
+			charset = strings.TrimPrefix(v, "charset=")
+		case v == "msb", v == "lsb":
+			bo := LSB0
+			if v == "msb" {
+				bo = MSB0
+			}
+			ret.bitOrder = &bo
+		case v == "reverse":
+			ret.reverse = true
+		case strings.HasPrefix(v, "checksum="):
+			ret.checksum = &checksumConfig{name: strings.TrimPrefix(v, "checksum=")}
+		default:
+			kv := strings.SplitN(v, "=", 2)
+			if len(kv) != 2 {
+				break
+			}
+			/* Name=From..To. The algorithm is looked up when it is computed. */
+			if _, ok := lookupChecksum(kv[0]); !ok && !strings.Contains(kv[1], "..") {
+				return nil, fmt.Errorf("unknown tag %q", v)
+			}
+			ret.checksum = parseChecksumRange(kv[0], kv[1])
 		}
 
 	}
-	return ret
+	if charset != "" {
+		if ret.str == nil {
+			return nil, fmt.Errorf("charset=%s requires str=, cstr or pstr=", charset)
+		}
+		if err := ret.str.setCharset(charset); err != nil {
+			return nil, err
+		}
+	}
+	if ret.reverse && (ret.str != nil || ret.fixed != nil || ret.scale != nil) {
+		return nil, fmt.Errorf("reverse is supported only for integer and Bit array")
+	}
+	if ret.fixed != nil {
+		if ret.bits > 0 {
+			return nil, fmt.Errorf("bits= and %s cannot be used together", ret.fixed)
+		}
+		/* the size of the field is decided by the format */
+		ret.bits = ret.fixed.size()
+	}
+	return ret, nil
 }
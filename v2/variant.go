@@ -0,0 +1,126 @@
+/*
+   Copyright 2020 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package bit
+
+import (
+	"fmt"
+	"github.com/goccy/go-reflect"
+	"strings"
+	"sync"
+)
+
+var variants = struct {
+	sync.RWMutex
+	m map[reflect.Type]map[int64]reflect.Type
+}{m: map[reflect.Type]map[int64]reflect.Type{}}
+
+// RegisterVariant registers prototype as a variant of the interface iface.
+// iface must be a pointer to the interface. e.g. (*Message)(nil)
+// The field which type is iface and has `bit:"switch=Name"` tag is decoded as the type of prototype
+// when the value of the field Name equals to value.
+// prototype may be a struct or a pointer to struct.
+// RegisterVariant panics if prototype doesn't implement iface.
+func RegisterVariant(iface interface{}, value int64, prototype interface{}) {
+	it := reflect.TypeOf(iface)
+	if it == nil || it.Kind() != reflect.Ptr || it.Elem().Kind() != reflect.Interface {
+		panic("bit: RegisterVariant: iface must be a pointer to interface")
+	}
+	it = it.Elem()
+	pt := reflect.TypeOf(prototype)
+	if pt == nil || !pt.Implements(it) {
+		panic(fmt.Sprintf("bit: RegisterVariant: %v doesn't implement %v", pt, it))
+	}
+
+	variants.Lock()
+	defer variants.Unlock()
+	if variants.m[it] == nil {
+		variants.m[it] = map[int64]reflect.Type{}
+	}
+	variants.m[it][value] = pt
+}
+
+func lookupVariant(it reflect.Type, value int64) (reflect.Type, bool) {
+	variants.RLock()
+	defer variants.RUnlock()
+	t, ok := variants.m[it][value]
+	return t, ok
+}
+
+// newVariant allocates the variant of f which is selected by the field specified by name.
+// It returns a pointer to the value to be decoded.
+// If byPtr is true, the variant is registered as a pointer type.
+func newVariant(v reflect.Value, f reflect.Value, name string) (ptr reflect.Value, byPtr bool, err error) {
+	if f.Kind() != reflect.Interface {
+		return reflect.Value{}, false, fmt.Errorf("switch is %w for %s", ErrUnsupportedType, f.Kind())
+	}
+	d, err := fieldByPath(v, strings.Split(name, "."))
+	if err != nil {
+		return reflect.Value{}, false, err
+	}
+	val, err := intOf(d)
+	if err != nil {
+		return reflect.Value{}, false, fmt.Errorf("switch=%s: %w", name, err)
+	}
+	t, ok := lookupVariant(f.Type(), val)
+	if !ok {
+		return reflect.Value{}, false, fmt.Errorf("switch=%s: variant of %v for %d is not registered", name, f.Type(), val)
+	}
+
+	if t.Kind() == reflect.Ptr {
+		return reflect.New(t.Elem()), true, nil
+	}
+	return reflect.New(t), false, nil
+}
+
+// checkVariant returns error if the concrete type of f is not the variant
+// selected by the field specified by name. Nil f is checked when it is written.
+func checkVariant(v reflect.Value, f reflect.Value, name string) error {
+	if f.Kind() != reflect.Interface {
+		return fmt.Errorf("switch is %w for %s", ErrUnsupportedType, f.Kind())
+	}
+	if f.IsNil() {
+		return nil
+	}
+	d, err := fieldByPath(v, strings.Split(name, "."))
+	if err != nil {
+		return err
+	}
+	val, err := intOf(d)
+	if err != nil {
+		return fmt.Errorf("switch=%s: %w", name, err)
+	}
+	t, ok := lookupVariant(f.Type(), val)
+	if !ok {
+		return fmt.Errorf("switch=%s: variant of %v for %d is not registered", name, f.Type(), val)
+	}
+	if f.Elem().Type() != t {
+		return fmt.Errorf("switch=%s: %v is not the variant for %d. expect %v", name, f.Elem().Type(), val, t)
+	}
+	return nil
+}
+
+// variantValue returns the concrete value of interface f.
+func variantValue(f reflect.Value) (reflect.Value, error) {
+	if f.IsNil() {
+		return reflect.Value{}, fmt.Errorf("variant %v is nil", f.Type())
+	}
+	e := f.Elem()
+	if e.Kind() == reflect.Ptr {
+		e = e.Elem()
+	}
+	return e, nil
+}
@@ -0,0 +1,122 @@
+/*
+   Copyright 2020 Takahiro Yamashita
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package bit_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/nokute78/go-bit/v2"
+	"testing"
+)
+
+type variantPayload interface {
+	isVariantPayload()
+}
+
+type variantPing struct {
+	Seq uint16
+}
+
+func (variantPing) isVariantPayload() {}
+
+type variantData struct {
+	Len  uint8
+	Data []byte `bit:"len=Len"`
+}
+
+func (*variantData) isVariantPayload() {}
+
+type variantMessage struct {
+	MsgType uint8
+	Payload variantPayload `bit:"switch=MsgType"`
+	Tail    uint8
+}
+
+func init() {
+	bit.RegisterVariant((*variantPayload)(nil), 1, variantPing{})
+	bit.RegisterVariant((*variantPayload)(nil), 2, &variantData{})
+}
+
+func TestReadVariant(t *testing.T) {
+	var m variantMessage
+	if err := bit.Read(bytes.NewReader([]byte{0x01, 0x34, 0x12, 0xff}), binary.LittleEndian, &m); err != nil {
+		t.Fatalf("error:%s", err)
+	}
+	p, ok := m.Payload.(variantPing)
+	if !ok {
+		t.Fatalf("type mismatch: %T", m.Payload)
+	}
+	if p.Seq != 0x1234 || m.Tail != 0xff {
+		t.Errorf("given=%+v", m)
+	}
+
+	if err := bit.Read(bytes.NewReader([]byte{0x02, 0x02, 0xaa, 0xbb, 0xff}), binary.LittleEndian, &m); err != nil {
+		t.Fatalf("error:%s", err)
+	}
+	d, ok := m.Payload.(*variantData)
+	if !ok {
+		t.Fatalf("type mismatch: %T", m.Payload)
+	}
+	if bytes.Compare(d.Data, []byte{0xaa, 0xbb}) != 0 || m.Tail != 0xff {
+		t.Errorf("given=%+v %+v", m, d)
+	}
+}
+
+func TestReadVariantNotRegistered(t *testing.T) {
+	var m variantMessage
+	if err := bit.Read(bytes.NewReader([]byte{0x03, 0x00}), binary.LittleEndian, &m); err == nil {
+		t.Errorf("error is not returned")
+	}
+}
+
+func TestWriteVariant(t *testing.T) {
+	type testcase struct {
+		name   string
+		input  variantMessage
+		expect []byte
+	}
+
+	cases := []testcase{
+		{"value", variantMessage{1, variantPing{0x1234}, 0xff}, []byte{0x01, 0x34, 0x12, 0xff}},
+		{"pointer", variantMessage{2, &variantData{Data: []byte{0xaa, 0xbb}}, 0xff}, []byte{0x02, 0x02, 0xaa, 0xbb, 0xff}},
+	}
+
+	for _, v := range cases {
+		buf := bytes.NewBuffer([]byte{})
+		if err := bit.Write(buf, binary.LittleEndian, &v.input); err != nil {
+			t.Fatalf("%s: bit.Write err=%s", v.name, err)
+		}
+		if bytes.Compare(buf.Bytes(), v.expect) != 0 {
+			t.Errorf("%s: mismatch\n given =%x\n expect=%x", v.name, buf.Bytes(), v.expect)
+		}
+	}
+}
+
+func TestWriteVariantMismatch(t *testing.T) {
+	cases := []variantMessage{
+		{2, variantPing{0x1234}, 0xff},
+		{1, &variantData{Data: []byte{0xaa}}, 0xff},
+		{1, &variantPing{0x1234}, 0xff},
+		{3, variantPing{0x1234}, 0xff},
+	}
+
+	for _, v := range cases {
+		if _, _, err := bit.Marshal(&v, binary.LittleEndian); err == nil {
+			t.Errorf("%d %T: bit.Marshal should fail", v.MsgType, v.Payload)
+		}
+	}
+}